@@ -0,0 +1,120 @@
+package zerver
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type (
+	// mountHandler serve request by a standard http.Handler, all methods are
+	// passed to it
+	mountHandler struct {
+		EmptyHandler
+		handler http.Handler
+		// sub means the route end with a catch-all for sub path, it's value
+		// is used as the request path of handler
+		sub bool
+	}
+
+	// responseWriter adapt Response to http.ResponseWriter
+	responseWriter struct {
+		Response
+	}
+
+	// urlVarsKey is the context key of url variables for mounted handler
+	urlVarsKey struct{}
+
+	// remainsHandler is implemented by handlers which serve sub paths by
+	// catch-all, the catch-all of them can match empty value
+	remainsHandler interface {
+		serveRemains()
+	}
+)
+
+// URLVars return url variables of a request served by mounted http.Handler
+func URLVars(r *http.Request) map[string]string {
+	vars, _ := r.Context().Value(urlVarsKey{}).(map[string]string)
+	return vars
+}
+
+// Mount mount a standard http.Handler to pattern and all sub paths of it,
+// pattern is stripped from the request path, url variables in pattern can be
+// accessed by URLVars
+func (rt *router) Mount(pattern string, handler http.Handler) error {
+	base := strings.TrimSuffix(pattern, "/")
+	err := rt.AddHandler(mountPattern(pattern), &mountHandler{handler: handler})
+	if err == nil {
+		err = rt.AddHandler(base+"/*", &mountHandler{handler: handler, sub: true})
+	}
+	return err
+}
+
+// mountPattern return the pattern of prefix itself registered by Mount and
+// Static, the trailing '/' is trimmed
+func mountPattern(prefix string) string {
+	if prefix = strings.TrimSuffix(prefix, "/"); prefix == "" {
+		return "/"
+	}
+	return prefix
+}
+
+func (*mountHandler) serveRemains() {}
+
+// Handler implements MethodIndicator, the mounted handler process all methods
+func (mh *mountHandler) Handler(string) HandlerFunc {
+	return mh.serve
+}
+
+func (mh *mountHandler) serve(req Request, resp Response) {
+	// let standard handler decide content type
+	resp.RemoveHeader(HEADER_CONTENTTYPE)
+	indexer := req.varIndexer()
+	path := "/"
+	if mh.sub {
+		path += indexer.values[len(indexer.values)-1]
+	}
+	r := req.Raw()
+	u := new(url.URL)
+	*u = *r.URL
+	u.Path, u.RawPath = path, ""
+	r = r.WithContext(context.WithValue(r.Context(), urlVarsKey{}, req.URLVars()))
+	r.URL = u
+	mh.handler.ServeHTTP(responseWriter{resp}, r)
+}
+
+// ResponseWriter adapt Response to http.ResponseWriter for libraries speak
+// net/http, WriteHeader only report status, it's written on first Write
+func ResponseWriter(resp Response) http.ResponseWriter {
+	return responseWriter{resp}
+}
+
+// Header return the header of underlying http.ResponseWriter
+func (w responseWriter) Header() http.Header {
+	return w.Raw().Header()
+}
+
+// WriteHeader only report status, it's written on first Write
+func (w responseWriter) WriteHeader(statusCode int) {
+	w.ReportStatus(statusCode)
+}
+
+// Middleware adapt a filter to standard middleware, the filter is not inited
+// and destroyed by server, and url variables is always empty
+func (s *Server) Middleware(filter Filter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+			env := Pool.newRequestEnv()
+			req, resp := env.req.init(s, w, request, Pool.newVarIndexer()), env.resp.init(s, w, request.TLS != nil)
+			defer func() {
+				req.destroy()
+				resp.destroy()
+				Pool.recycleRequestEnv(env)
+			}()
+			filter.Filter(req, resp, func(req Request, resp Response) {
+				next.ServeHTTP(responseWriter{resp}, req.Raw())
+			})
+		})
+	}
+}
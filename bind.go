@@ -0,0 +1,603 @@
+package zerver
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	. "github.com/cosiner/golib/errors"
+)
+
+type (
+	// FieldError is the error of a field when binding or validating
+	FieldError struct {
+		Field   string `json:"field"`
+		Rule    string `json:"rule"`
+		Message string `json:"message"`
+	}
+
+	bindStruct struct {
+		fields []bindField
+	}
+
+	bindField struct {
+		index    []int
+		name     string // name in field error
+		jsonName string
+		xmlName  string
+		sources  []bindSource
+		rules    []bindRule
+		nested   bool // struct field without sources, validate it recursively
+	}
+
+	// bindSupplied record which fields are supplied by request, rules except
+	// required only apply to supplied fields
+	bindSupplied struct {
+		bound []bool                 // by index of bindStruct.fields, bound from path, query, header or form
+		body  map[string]interface{} // keys of json object or xml element, nested objects are maps
+		xml   bool
+	}
+
+	bindSource struct {
+		tag, key string
+	}
+
+	bindRule struct {
+		name  string
+		num   float64
+		enum  []string
+		regex *regexp.Regexp
+	}
+)
+
+const (
+	_BIND_PATH     = "path"
+	_BIND_QUERY    = "query"
+	_BIND_HEADER   = "header"
+	_BIND_FORM     = "form"
+	_BIND_VALIDATE = "validate"
+
+	_RULE_TYPE     = "type"
+	_RULE_REQUIRED = "required"
+	_RULE_MIN      = "min"
+	_RULE_MAX      = "max"
+	_RULE_ENUM     = "enum"
+	_RULE_REGEXP   = "regexp"
+
+	ErrBindTarget = Err("bind target must be a pointer to struct")
+)
+
+var (
+	bindStructs  sync.Map // reflect.Type:*bindStruct
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// Bind decode request into a pointer to struct, then validate it.
+//
+// Body is decoded by content type: json and xml body is decoded by standard
+// library, so "json" and "xml" tags are used, urlencoded and multipart form
+// fill fields with "form" tag. Then fields with "path", "query" and "header"
+// tags are filled from url variables, url query and request header, they
+// override values decoded from body. Slice fields accept multiple values.
+//
+// Validation rules are declared in "validate" tag, seperated by ',':
+//
+//	required: value must not be zero
+//	min=n, max=n: limit of number, or length of string, slice and map
+//	enum=a|b|c: value must be one of them
+//	regexp=expr: string must match the expression, it must be the last rule
+//	because it consumes the rest of tag
+//
+// Rules except required only apply to fields supplied by request, so absent
+// optional fields are not validated, but supplied zero values are. Nested
+// struct fields are validated recursively.
+//
+// If request can't be decoded, an *HTTPError with status 400 is returned,
+// if validation failed, it's 422, Fields of it list each field error.
+// Other errors are programming errors, such as invalid tags.
+func (req *request) Bind(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return ErrBindTarget
+	}
+	v = v.Elem()
+	bs, err := parseBindStruct(v.Type())
+	if err != nil {
+		return err
+	}
+	supplied := bindSupplied{bound: make([]bool, len(bs.fields))}
+	if err = req.bindBody(dst, v, bs, &supplied); err != nil {
+		return err
+	}
+	var fieldErrs []FieldError
+	bs.each(v, func(i int, f *bindField, fv reflect.Value) {
+		for _, src := range f.sources {
+			values := req.bindValues(src)
+			if len(values) == 0 {
+				continue
+			}
+			supplied.bound[i] = true
+			if err := setValues(fv, values); err != nil {
+				fieldErrs = append(fieldErrs, FieldError{
+					Field:   f.name,
+					Rule:    _RULE_TYPE,
+					Message: fmt.Sprintf("invalid value %q", values[0]),
+				})
+			}
+			break
+		}
+	})
+	if len(fieldErrs) > 0 {
+		return bindError(http.StatusBadRequest, fieldErrs, nil)
+	}
+	if fieldErrs, err = validateStruct(v, bs, "", &supplied, fieldErrs); err != nil {
+		return err
+	}
+	if len(fieldErrs) > 0 {
+		return bindError(http.StatusUnprocessableEntity, fieldErrs, nil)
+	}
+	return nil
+}
+
+// bindBody decode request body by content type, empty body is skipped, keys of
+// json and xml body are recorded to supplied
+func (req *request) bindBody(dst interface{}, v reflect.Value, bs *bindStruct, supplied *bindSupplied) error {
+	ct := req.ContentType()
+	if ct == "" {
+		return nil
+	}
+	typ, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return bindError(http.StatusUnsupportedMediaType, nil, err)
+	}
+	var data []byte
+	req.limitBody()
+	switch {
+	case typ == CONTENTTYPE_JSON || strings.HasSuffix(typ, "+json"):
+		if data, err = io.ReadAll(req); err == nil && len(data) > 0 {
+			if err = json.Unmarshal(data, dst); err == nil {
+				json.Unmarshal(data, &supplied.body)
+			}
+		}
+	case typ == CONTENTTYPE_XML || typ == "text/xml" || strings.HasSuffix(typ, "+xml"):
+		if data, err = io.ReadAll(req); err == nil && len(data) > 0 {
+			if err = xml.Unmarshal(data, dst); err == nil {
+				supplied.body, supplied.xml = xmlKeys(data), true
+			}
+		}
+	case typ == "application/x-www-form-urlencoded" || typ == "multipart/form-data":
+		return req.bindForm(v, bs, supplied)
+	default:
+		if req.request.ContentLength == 0 {
+			return nil
+		}
+		return bindError(http.StatusUnsupportedMediaType, nil, Errorf("unsupported content type %s", typ))
+	}
+	if err == nil {
+		return nil
+	}
+	var (
+		typeErr  *json.UnmarshalTypeError
+		tooLarge *http.MaxBytesError
+	)
+	switch {
+	case errors.As(err, &typeErr):
+		return bindError(http.StatusBadRequest, []FieldError{{
+			Field:   typeErr.Field,
+			Rule:    _RULE_TYPE,
+			Message: "invalid value of type " + typeErr.Value,
+		}}, err)
+	case errors.As(err, &tooLarge):
+		return bindError(http.StatusRequestEntityTooLarge, nil, ErrBodyTooLarge)
+	}
+	return bindError(http.StatusBadRequest, nil, err)
+}
+
+// bindForm fill fields with "form" tag from form values
+func (req *request) bindForm(v reflect.Value, bs *bindStruct, supplied *bindSupplied) error {
+	if err := req.ParseForm(); err != nil {
+		if err == ErrBodyTooLarge {
+			return bindError(http.StatusRequestEntityTooLarge, nil, err)
+		}
+		return bindError(http.StatusBadRequest, nil, err)
+	}
+	var fieldErrs []FieldError
+	bs.each(v, func(i int, f *bindField, fv reflect.Value) {
+		for _, src := range f.sources {
+			if src.tag != _BIND_FORM {
+				continue
+			}
+			if values := req.form[src.key]; len(values) > 0 {
+				supplied.bound[i] = true
+				if err := setValues(fv, values); err != nil {
+					fieldErrs = append(fieldErrs, FieldError{
+						Field:   f.name,
+						Rule:    _RULE_TYPE,
+						Message: fmt.Sprintf("invalid value %q", values[0]),
+					})
+				}
+			}
+		}
+	})
+	if len(fieldErrs) > 0 {
+		return bindError(http.StatusBadRequest, fieldErrs, nil)
+	}
+	return nil
+}
+
+// bindValues return values of path, query or header source, form is bound
+// with body
+func (req *request) bindValues(src bindSource) []string {
+	switch src.tag {
+	case _BIND_PATH:
+		if value := req.URLVar(src.key); value != "" {
+			return []string{value}
+		}
+	case _BIND_QUERY:
+		return req.Params(src.key)
+	case _BIND_HEADER:
+		return req.header.Values(src.key)
+	}
+	return nil
+}
+
+func bindError(status int, fields []FieldError, err error) *HTTPError {
+	he := NewHTTPError(status, 0, "")
+	he.Fields, he.Err = fields, err
+	return he
+}
+
+// parseBindStruct parse fields and rules of struct type, result is cached
+func parseBindStruct(t reflect.Type) (*bindStruct, error) {
+	if bs, has := bindStructs.Load(t); has {
+		return bs.(*bindStruct), nil
+	}
+	bs := new(bindStruct)
+	if err := bs.parse(t, nil); err != nil {
+		return nil, err
+	}
+	bindStructs.Store(t, bs)
+	return bs, nil
+}
+
+func (bs *bindStruct) parse(t reflect.Type, index []int) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous { // unexported
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		f := bindField{index: fieldIndex}
+		for _, tag := range [...]string{_BIND_PATH, _BIND_QUERY, _BIND_HEADER, _BIND_FORM} {
+			if key := sf.Tag.Get(tag); key != "" && key != "-" {
+				f.sources = append(f.sources, bindSource{tag: tag, key: key})
+			}
+		}
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		isStruct := ft.Kind() == reflect.Struct && ft != timeType
+		if sf.Anonymous && isStruct && sf.Type.Kind() == reflect.Struct && len(f.sources) == 0 {
+			if err := bs.parse(ft, fieldIndex); err != nil {
+				return err
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		f.name = bindFieldName(sf, f.sources)
+		f.jsonName, f.xmlName = tagName(sf, "json"), tagName(sf, "xml")
+		rules, err := parseRules(sf.Tag.Get(_BIND_VALIDATE))
+		if err != nil {
+			return Errorf("field %s.%s: %s", t.Name(), sf.Name, err.Error())
+		}
+		f.rules, f.nested = rules, isStruct && len(f.sources) == 0
+		if len(f.sources) > 0 || len(f.rules) > 0 || f.nested {
+			bs.fields = append(bs.fields, f)
+		}
+	}
+	return nil
+}
+
+// bindFieldName use name of the first source, or json name, or field name
+func bindFieldName(sf reflect.StructField, sources []bindSource) string {
+	if len(sources) > 0 {
+		return sources[0].key
+	}
+	return tagName(sf, "json")
+}
+
+// tagName return the name of field in json or xml tag, default is field name,
+// for xml path such as "a>b", it's the first element
+func tagName(sf reflect.StructField, tag string) string {
+	name := strings.Split(sf.Tag.Get(tag), ",")[0]
+	if tag == "xml" {
+		name = strings.Split(name, ">")[0]
+	}
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+// xmlKeys collect names of elements and attributes of xml document, children
+// of element are nested maps
+func xmlKeys(data []byte) map[string]interface{} {
+	var (
+		d     = xml.NewDecoder(bytes.NewReader(data))
+		root  map[string]interface{}
+		stack []map[string]interface{}
+	)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return root
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			m := make(map[string]interface{}, len(t.Attr))
+			for _, a := range t.Attr {
+				m[a.Name.Local] = true
+			}
+			if len(stack) == 0 {
+				root = m
+			} else {
+				stack[len(stack)-1][t.Name.Local] = m
+			}
+			stack = append(stack, m)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// has check whether field is supplied, the nested object of body is also
+// returned. Keys of json are matched case-insensitive like encoding/json
+func (s *bindSupplied) has(i int, f *bindField) (bool, map[string]interface{}) {
+	if i < len(s.bound) && s.bound[i] {
+		return true, nil
+	}
+	name := f.jsonName
+	if s.xml {
+		name = f.xmlName
+	}
+	value, has := s.body[name]
+	if !has && !s.xml {
+		for k, v := range s.body {
+			if strings.EqualFold(k, name) {
+				value, has = v, true
+				break
+			}
+		}
+	}
+	nested, _ := value.(map[string]interface{})
+	return has, nested
+}
+
+func parseRules(tag string) ([]bindRule, error) {
+	if tag == "" {
+		return nil, nil
+	}
+	var rules []bindRule
+	parts := strings.Split(tag, ",")
+	for i := 0; i < len(parts); i++ {
+		name, arg := parts[i], ""
+		if eq := strings.IndexByte(name, '='); eq >= 0 {
+			name, arg = name[:eq], name[eq+1:]
+		}
+		r := bindRule{name: name}
+		var err error
+		switch name {
+		case _RULE_REQUIRED:
+		case _RULE_MIN, _RULE_MAX:
+			r.num, err = strconv.ParseFloat(arg, 64)
+		case _RULE_ENUM:
+			r.enum = strings.Split(arg, "|")
+		case _RULE_REGEXP:
+			arg = strings.Join(append([]string{arg}, parts[i+1:]...), ",")
+			i = len(parts)
+			r.regex, err = regexp.Compile(arg)
+		default:
+			err = Errorf("unknown validate rule %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// each call fn with each field has sources
+func (bs *bindStruct) each(v reflect.Value, fn func(int, *bindField, reflect.Value)) {
+	for i := range bs.fields {
+		f := &bs.fields[i]
+		if len(f.sources) > 0 {
+			fn(i, f, v.FieldByIndex(f.index))
+		}
+	}
+}
+
+// validateStruct validate fields of struct, field errors are appended to
+// errs, prefix is the name of parent fields
+func validateStruct(v reflect.Value, bs *bindStruct, prefix string, supplied *bindSupplied,
+	errs []FieldError) ([]FieldError, error) {
+	for i := range bs.fields {
+		f := &bs.fields[i]
+		fv := v.FieldByIndex(f.index)
+		name := prefix + f.name
+		has, body := supplied.has(i, f)
+		if fv.IsZero() && f.required() {
+			errs = append(errs, FieldError{Field: name, Rule: _RULE_REQUIRED, Message: "is required"})
+			continue
+		}
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		if has {
+			for j := range f.rules {
+				if msg := f.rules[j].check(fv); msg != "" {
+					errs = append(errs, FieldError{Field: name, Rule: f.rules[j].name, Message: msg})
+				}
+			}
+		}
+		// fields of zero struct may be required
+		if f.nested {
+			nbs, err := parseBindStruct(fv.Type())
+			if err != nil {
+				return nil, err
+			}
+			nested := &bindSupplied{body: body, xml: supplied.xml}
+			if errs, err = validateStruct(fv, nbs, name+".", nested, errs); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return errs, nil
+}
+
+func (f *bindField) required() bool {
+	for i := range f.rules {
+		if f.rules[i].name == _RULE_REQUIRED {
+			return true
+		}
+	}
+	return false
+}
+
+// check return error message if value is invalid
+func (r *bindRule) check(v reflect.Value) string {
+	switch r.name {
+	case _RULE_MIN, _RULE_MAX:
+		n, isLen := ruleNumber(v)
+		what := "must be"
+		if isLen {
+			what = "length must be"
+		}
+		if r.name == _RULE_MIN && n < r.num {
+			return fmt.Sprintf("%s at least %v", what, r.num)
+		}
+		if r.name == _RULE_MAX && n > r.num {
+			return fmt.Sprintf("%s at most %v", what, r.num)
+		}
+	case _RULE_ENUM:
+		s := fmt.Sprint(v.Interface())
+		for _, e := range r.enum {
+			if s == e {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(r.enum, ", ")
+	case _RULE_REGEXP:
+		if v.Kind() == reflect.String && !r.regex.MatchString(v.String()) {
+			return "must match " + r.regex.String()
+		}
+	}
+	return ""
+}
+
+// ruleNumber return the number compared by min and max, for string, slice
+// and map, it's length
+func ruleNumber(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false
+	}
+	return 0, false
+}
+
+// setValues set string values to field, slice field accept all values,
+// otherwise only the first is used
+func setValues(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(s.Index(i), value); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setValue(v, values[0])
+}
+
+func setValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := setValue(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if u, is := v.Addr().Interface().(encoding.TextUnmarshaler); is {
+		return u.UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
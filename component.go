@@ -0,0 +1,124 @@
+package zerver
+
+import (
+	. "github.com/cosiner/golib/errors"
+)
+
+type (
+	// Component is a server component such as database pool, cache or session
+	// manager, all components are inited before filters and handlers in the order
+	// of their dependencies, and destroyed after them in reverse order
+	Component interface {
+		ServerInitializer
+		Destroy()
+	}
+
+	// component hold a component and it's dependencies
+	component struct {
+		name string
+		deps []string
+		Component
+	}
+
+	// components manage all components of server
+	components struct {
+		names  []string // registration order
+		comps  map[string]*component
+		inited []*component // init order
+	}
+)
+
+const (
+	ErrComponentExist = Err("component already exist")
+)
+
+// add add a component
+func (cs *components) add(name string, c Component, deps []string) error {
+	if cs.comps == nil {
+		cs.comps = make(map[string]*component)
+	}
+	if _, has := cs.comps[name]; has {
+		return ErrComponentExist
+	}
+	cs.names = append(cs.names, name)
+	cs.comps[name] = &component{
+		name:      name,
+		deps:      deps,
+		Component: c,
+	}
+	return nil
+}
+
+// get return component by name
+func (cs *components) get(name string) Component {
+	if c := cs.comps[name]; c != nil {
+		return c.Component
+	}
+	return nil
+}
+
+// sort sort components by dependencies, components without dependency relation
+// keep their registration order
+func (cs *components) sort() ([]*component, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	var (
+		sorted = make([]*component, 0, len(cs.names))
+		states = make(map[string]int, len(cs.names))
+		visit  func(name, from string) error
+	)
+	visit = func(name, from string) error {
+		c := cs.comps[name]
+		if c == nil {
+			return Errorf("component %s depends on a non-exist component %s", from, name)
+		}
+		switch states[name] {
+		case visiting:
+			return Errorf("component %s has circular dependency", name)
+		case visited:
+			return nil
+		}
+		states[name] = visiting
+		for _, dep := range c.deps {
+			if err := visit(dep, name); err != nil {
+				return err
+			}
+		}
+		states[name] = visited
+		sorted = append(sorted, c)
+		return nil
+	}
+	for _, name := range cs.names {
+		if err := visit(name, ""); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// init init all components in dependency order, if any one failed, those inited
+// will be destroyed
+func (cs *components) init(s *Server) error {
+	sorted, err := cs.sort()
+	if err != nil {
+		return err
+	}
+	for _, c := range sorted {
+		if err = c.Init(s); err != nil {
+			cs.destroy()
+			return Errorf("init component %s: %s", c.name, err.Error())
+		}
+		cs.inited = append(cs.inited, c)
+	}
+	return nil
+}
+
+// destroy destroy all inited components in reverse order
+func (cs *components) destroy() {
+	for i := len(cs.inited) - 1; i >= 0; i-- {
+		cs.inited[i].Destroy()
+	}
+	cs.inited = nil
+}
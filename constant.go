@@ -13,6 +13,10 @@ const (
 	HEADER_ACCEPTENCODING  = "Accept-Encoding"
 	HEADER_CACHECONTROL    = "Cache-Control"
 	HEADER_EXPIRES         = "Expires"
+	HEADER_ALLOW           = "Allow"
+	HEADER_LOCATION        = "Location"
+	HEADER_ETAG            = "ETag"
+	HEADER_VARY            = "Vary"
 
 	// ContentEncoding
 	ENCODING_GZIP    = "gzip"
@@ -24,7 +28,11 @@ const (
 	DELETE         = "DELETE"
 	PUT            = "PUT"
 	PATCH          = "PATCH"
+	HEAD           = "HEAD"
+	OPTIONS        = "OPTIONS"
 	UNKNOWN_METHOD = "UNKNOWN"
+	// TASK is the method of request passed to filters of task
+	TASK = "TASK"
 
 	// Content Type
 	CONTNTTYPE_PLAIN = "text/plain"
@@ -49,3 +57,18 @@ func parseContentType(str string) string {
 	}
 	return strings.ToLower(strings.TrimSpace(str))
 }
+
+// isValidMethod check whether method is a valid token defined in RFC 7230
+func isValidMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for i := 0; i < len(method); i++ {
+		c := method[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,265 @@
+package zerver
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/cosiner/golib/errors"
+)
+
+type (
+	// CookieCodec sign and encrypt cookie values, the first key is used to
+	// sign and encrypt, all keys are tried to verify and decrypt, so keys can
+	// be rotated by putting a new key at first and keeping old keys for a while.
+	//
+	// Cookie name and expire time are protected together with value, so value
+	// can't be moved to another cookie or used after expired.
+	CookieCodec struct {
+		keys []cookieKey
+	}
+
+	cookieKey struct {
+		sign []byte
+		aead cipher.AEAD
+	}
+)
+
+const (
+	ErrNoCookieCodec = Err("cookie codec is not set")
+	ErrNoCookieKey   = Err("no cookie key or empty key")
+	ErrCookieInvalid = Err("cookie is invalid or tampered")
+	ErrCookieExpired = Err("cookie is expired")
+)
+
+var cookieEncoding = base64.RawURLEncoding
+
+// NewCookieCodec create a cookie codec, keys can be any length, sign and
+// encrypt keys are derived from them by HMAC-SHA256
+func NewCookieCodec(keys ...[]byte) (*CookieCodec, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoCookieKey
+	}
+	c := &CookieCodec{keys: make([]cookieKey, len(keys))}
+	for i, key := range keys {
+		if len(key) == 0 {
+			return nil, ErrNoCookieKey
+		}
+		block, err := aes.NewCipher(deriveKey(key, "encrypt"))
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.keys[i] = cookieKey{sign: deriveKey(key, "sign"), aead: aead}
+	}
+	return c, nil
+}
+
+func deriveKey(key []byte, usage string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("zerver-cookie-" + usage))
+	return mac.Sum(nil)
+}
+
+// Sign return signed value of cookie, lifetime is by seconds, 0 means never
+// expire
+func (c *CookieCodec) Sign(name, value string, lifetime int) string {
+	payload := cookieEncoding.EncodeToString([]byte(cookiePayload(value, lifetime)))
+	return payload + "." + cookieEncoding.EncodeToString(c.keys[0].mac(name, payload))
+}
+
+// Verify verify signed value and return the original value
+func (c *CookieCodec) Verify(name, signed string) (string, error) {
+	dot := strings.LastIndexByte(signed, '.')
+	if dot < 0 {
+		return "", ErrCookieInvalid
+	}
+	payload := signed[:dot]
+	sum, err := cookieEncoding.DecodeString(signed[dot+1:])
+	if err != nil {
+		return "", ErrCookieInvalid
+	}
+	for i := range c.keys {
+		if hmac.Equal(sum, c.keys[i].mac(name, payload)) {
+			data, err := cookieEncoding.DecodeString(payload)
+			if err != nil {
+				return "", ErrCookieInvalid
+			}
+			return parseCookiePayload(string(data))
+		}
+	}
+	return "", ErrCookieInvalid
+}
+
+// Encrypt return encrypted value of cookie, lifetime is by seconds, 0 means
+// never expire
+func (c *CookieCodec) Encrypt(name, value string, lifetime int) (string, error) {
+	aead := c.keys[0].aead
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+32)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	data := aead.Seal(nonce, nonce, []byte(cookiePayload(value, lifetime)), []byte(name))
+	return cookieEncoding.EncodeToString(data), nil
+}
+
+// Decrypt decrypt encrypted value and return the original value
+func (c *CookieCodec) Decrypt(name, encrypted string) (string, error) {
+	data, err := cookieEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", ErrCookieInvalid
+	}
+	for i := range c.keys {
+		aead := c.keys[i].aead
+		if len(data) < aead.NonceSize() {
+			return "", ErrCookieInvalid
+		}
+		nonce, text := data[:aead.NonceSize()], data[aead.NonceSize():]
+		if plain, err := aead.Open(nil, nonce, text, []byte(name)); err == nil {
+			return parseCookiePayload(string(plain))
+		}
+	}
+	return "", ErrCookieInvalid
+}
+
+func (k *cookieKey) mac(name, payload string) []byte {
+	mac := hmac.New(sha256.New, k.sign)
+	mac.Write([]byte(name))
+	mac.Write([]byte{'|'})
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// cookiePayload prefix value with expire time by unix seconds
+func cookiePayload(value string, lifetime int) string {
+	var expires int64
+	if lifetime > 0 {
+		expires = time.Now().Unix() + int64(lifetime)
+	}
+	return strconv.FormatInt(expires, 10) + "|" + value
+}
+
+func parseCookiePayload(payload string) (string, error) {
+	sep := strings.IndexByte(payload, '|')
+	if sep < 0 {
+		return "", ErrCookieInvalid
+	}
+	expires, err := strconv.ParseInt(payload[:sep], 10, 64)
+	if err != nil {
+		return "", ErrCookieInvalid
+	}
+	if expires != 0 && expires < time.Now().Unix() {
+		return "", ErrCookieExpired
+	}
+	return payload[sep+1:], nil
+}
+
+// Cookie return cookie value with given name, if not exist, return ""
+func (req *request) Cookie(name string) string {
+	if c, err := req.request.Cookie(name); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// SignedCookie return value of cookie set by Response.SetSignedCookie,
+// http.ErrNoCookie is returned if cookie not exist
+func (req *request) SignedCookie(name string) (string, error) {
+	codec, value, err := req.codecCookie(name)
+	if err != nil {
+		return "", err
+	}
+	return codec.Verify(name, value)
+}
+
+// SecureCookie return value of cookie set by Response.SetSecureCookie,
+// http.ErrNoCookie is returned if cookie not exist
+func (req *request) SecureCookie(name string) (string, error) {
+	codec, value, err := req.codecCookie(name)
+	if err != nil {
+		return "", err
+	}
+	return codec.Decrypt(name, value)
+}
+
+func (req *request) codecCookie(name string) (*CookieCodec, string, error) {
+	codec := req.Server().CookieCodec
+	if codec == nil {
+		return nil, "", ErrNoCookieCodec
+	}
+	c, err := req.request.Cookie(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return codec, c.Value, nil
+}
+
+// SetCookie set cookie for path "/" with HttpOnly and SameSite=Lax, Secure is
+// set if request is https or Server.CookieSecure is true. Lifetime is by
+// seconds, 0 means cookie is deleted after browser closed, negative means
+// delete cookie now
+func (resp *response) SetCookie(name, value string, lifetime int) {
+	resp.setCookie(name, value, lifetime, true)
+}
+
+// SetScriptCookie set cookie like SetCookie, but without HttpOnly
+func (resp *response) SetScriptCookie(name, value string, lifetime int) {
+	resp.setCookie(name, value, lifetime, false)
+}
+
+func (resp *response) setCookie(name, value string, lifetime int, httpOnly bool) {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   lifetime,
+		HttpOnly: httpOnly,
+		Secure:   resp.secure || resp.Server().CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if lifetime > 0 {
+		c.Expires = time.Now().Add(time.Duration(lifetime) * time.Second)
+	}
+	resp.SetAdvancedCookie(c)
+}
+
+// SetSignedCookie set cookie signed by Server.CookieCodec, value is readable
+// by client but can't be modified
+func (resp *response) SetSignedCookie(name, value string, lifetime int) error {
+	codec := resp.Server().CookieCodec
+	if codec == nil {
+		return ErrNoCookieCodec
+	}
+	resp.SetCookie(name, codec.Sign(name, value, lifetime), lifetime)
+	return nil
+}
+
+// SetSecureCookie set cookie encrypted by Server.CookieCodec, value is neither
+// readable nor modifiable by client
+func (resp *response) SetSecureCookie(name, value string, lifetime int) error {
+	codec := resp.Server().CookieCodec
+	if codec == nil {
+		return ErrNoCookieCodec
+	}
+	value, err := codec.Encrypt(name, value, lifetime)
+	if err == nil {
+		resp.SetCookie(name, value, lifetime)
+	}
+	return err
+}
+
+// DeleteClientCookie delete user browser's cookie by name
+func (resp *response) DeleteClientCookie(name string) {
+	resp.SetCookie(name, "", -1)
+}
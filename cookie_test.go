@@ -0,0 +1,106 @@
+package zerver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cosiner/golib/test"
+)
+
+func TestCookieCodec(t *testing.T) {
+	tt := test.WrapTest(t)
+	_, err := NewCookieCodec()
+	tt.AssertEq(err, ErrNoCookieKey)
+
+	old, _ := NewCookieCodec([]byte("old key"))
+	rotated, _ := NewCookieCodec([]byte("new key"), []byte("old key"))
+	other, _ := NewCookieCodec([]byte("other key"))
+
+	signed := old.Sign("user", "bob", 0)
+	value, err := rotated.Verify("user", signed)
+	tt.AssertNil(err)
+	tt.AssertEq(value, "bob")
+	_, err = rotated.Verify("admin", signed)
+	tt.AssertEq(err, ErrCookieInvalid)
+	_, err = other.Verify("user", signed)
+	tt.AssertEq(err, ErrCookieInvalid)
+	_, err = old.Verify("user", "x"+signed)
+	tt.AssertEq(err, ErrCookieInvalid)
+
+	encrypted, err := old.Encrypt("user", "bob", 0)
+	tt.AssertNil(err)
+	tt.AssertTrue(!strings.Contains(encrypted, "bob"))
+	value, err = rotated.Decrypt("user", encrypted)
+	tt.AssertNil(err)
+	tt.AssertEq(value, "bob")
+	_, err = rotated.Decrypt("admin", encrypted)
+	tt.AssertEq(err, ErrCookieInvalid)
+	_, err = other.Decrypt("user", encrypted)
+	tt.AssertEq(err, ErrCookieInvalid)
+
+	// new cookies can't be read by codec which don't know the new key
+	_, err = old.Verify("user", rotated.Sign("user", "bob", 0))
+	tt.AssertEq(err, ErrCookieInvalid)
+
+	_, err = parseCookiePayload("1|bob")
+	tt.AssertEq(err, ErrCookieExpired)
+}
+
+func TestCookie(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	s.CookieCodec, _ = NewCookieCodec([]byte("key"))
+	s.Get("/set", func(req Request, resp Response) {
+		resp.SetCookie("plain", "a", 0)
+		tt.AssertNil(resp.SetSignedCookie("signed", "b", 60))
+		tt.AssertNil(resp.SetSecureCookie("secure", "c", 60))
+		resp.DeleteClientCookie("old")
+		resp.SetScriptCookie("script", "d", 0)
+	})
+	s.Get("/get", func(req Request, resp Response) {
+		signed, err := req.SignedCookie("signed")
+		if err != nil {
+			resp.ReportBadRequest()
+			return
+		}
+		secure, err := req.SecureCookie("secure")
+		if err != nil {
+			resp.ReportBadRequest()
+			return
+		}
+		resp.Write([]byte(req.Cookie("plain") + signed + secure))
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/set", nil))
+	cookies := w.Result().Cookies()
+	tt.AssertEq(len(cookies), 5)
+	for _, c := range cookies {
+		tt.AssertTrue(c.SameSite == http.SameSiteLaxMode && c.Path == "/")
+		tt.AssertTrue(!c.Secure)
+		tt.AssertEq(c.HttpOnly, c.Name != "script")
+	}
+	tt.AssertTrue(cookies[3].Name == "old" && cookies[3].MaxAge < 0)
+
+	get := func(cookies []*http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/get", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+	w = get(cookies[:3])
+	tt.AssertEq(w.Body.String(), "abc")
+
+	cookies[1].Value = strings.Replace(cookies[1].Value, cookies[1].Value[:2], "xx", 1)
+	tt.AssertEq(get(cookies[:3]).Code, http.StatusBadRequest)
+
+	s.CookieSecure = true
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/set", nil))
+	tt.AssertTrue(w.Result().Cookies()[0].Secure)
+}
@@ -0,0 +1,111 @@
+package zerver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type (
+	// ErrHandlerFunc is a handler function which return error instead of
+	// writing error response itself, use HandleError to convert it to
+	// HandlerFunc then it can be registered as a normal HandlerFunc such as
+	// Get, Post or fields of OptionHandler
+	ErrHandlerFunc func(Request, Response) error
+
+	// ErrorHandler convert error returned by ErrHandlerFunc to response
+	ErrorHandler func(req Request, resp Response, err error)
+
+	// HTTPError is a standard error carry http status, application error code
+	// and message to user
+	HTTPError struct {
+		Status  int    `json:"-"`
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message"`
+		// Fields is the errors of request fields, such as returned by
+		// Request.Bind
+		Fields []FieldError `json:"fields,omitempty"`
+		// Err is the underlying error, it will never be sent to user
+		Err error `json:"-"`
+	}
+)
+
+// NewHTTPError create a new HTTPError, if message is empty, use status text
+func NewHTTPError(status, code int, message string) *HTTPError {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return &HTTPError{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+// Error implements error interface
+func (e *HTTPError) Error() string {
+	msg := e.Message
+	for _, f := range e.Fields {
+		msg += "; " + f.Field + " " + f.Message
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap return the underlying error
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// HandleError convert an ErrHandlerFunc to HandlerFunc, returned error will be
+// processed by Server.ErrorHandler, it runs inside the filter chain, so
+// filters can still see the final status after chain returned
+func HandleError(fn ErrHandlerFunc) HandlerFunc {
+	return func(req Request, resp Response) {
+		if err := fn(req, resp); err != nil {
+			req.Server().handleError(req, resp, err)
+		}
+	}
+}
+
+// handleError pass error to ErrorHandler, default use DefaultErrorHandler
+func (s *Server) handleError(req Request, resp Response, err error) {
+	handler := s.ErrorHandler
+	if handler == nil {
+		handler = DefaultErrorHandler
+	}
+	handler(req, resp, err)
+}
+
+// DefaultErrorHandler report status of HTTPError and write code and message,
+// if server's content type is json, they will be encoded as json object,
+// otherwise message and field errors are written as plain text, one per line.
+// For other errors, error is logged, and only a 500 is reported to user.
+// HTTPError without status is also reported as 500.
+func DefaultErrorHandler(req Request, resp Response, err error) {
+	var he *HTTPError
+	if !errors.As(err, &he) {
+		log.Printf("Error when serve %s %s: %s", req.Method(), req.URL().Path, err)
+		he = NewHTTPError(http.StatusInternalServerError, 0, "")
+	}
+	status := he.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	resp.ReportStatus(status)
+	if strings.HasPrefix(req.Server().ContentType, CONTENTTYPE_JSON) {
+		resp.SetContentType(CONTENTTYPE_JSON)
+		json.NewEncoder(resp).Encode(he)
+	} else {
+		resp.SetContentType(CONTNTTYPE_PLAIN)
+		msg := he.Message
+		for _, f := range he.Fields {
+			msg += "\n" + f.Field + ": " + f.Message
+		}
+		resp.Write([]byte(msg))
+	}
+}
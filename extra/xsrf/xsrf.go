@@ -117,7 +117,8 @@ func (x *xsrf) Set(_ zerver.Request, resp zerver.Response) (value string) {
 		x.RLock()
 		value = x.value
 		x.RUnlock()
-		resp.SetCookie(XSRF_NAME, value, x.valueLifetime)
+		// client scripts need read it to set the request header
+		resp.SetScriptCookie(XSRF_NAME, value, x.valueLifetime)
 	}
 	return
 }
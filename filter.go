@@ -72,9 +72,14 @@ func NewRootFilters(filters []Filter) RootFilters {
 	return &rfs
 }
 
+// Init init all root filters, if one of them failed, destroy inited ones in
+// reverse order
 func (rfs *rootFilters) Init(s *Server) error {
-	for _, f := range *rfs {
+	for i, f := range *rfs {
 		if err := f.Init(s); err != nil {
+			for i--; i >= 0; i-- {
+				(*rfs)[i].Destroy()
+			}
 			return err
 		}
 	}
@@ -101,34 +106,23 @@ func (rfs *rootFilters) Destroy() {
 	}
 }
 
-// newFilterChain create a chain of filter
+// init setup filters and final handler of filter chain
 //
-// NOTICE: FilterChain keeps some states, it should be used only once
+// NOTICE: filterChain keeps some states, it should be used only once
 // if need unlimit FilterChain, use InterceptHandler replace
-// but it takes less memory space, InterceptHandler takes more, make your choice
-func newFilterChain(filters []Filter, handler func(Request, Response)) FilterChain {
+func (chain *filterChain) init(filters []Filter, handler HandlerFunc) {
 	if handler == nil {
 		handler = EmptyHandlerFunc
 	}
-	if l := len(filters); l == 0 {
-		return handler
-	} else if l == 1 {
-		return newInterceptHandler(handler, filters[0])
-	}
-	chain := Pool.newFilterChain()
 	chain.filters = filters
 	chain.handler = handler
-	return chain.handleChain
 }
 
 // handleChain call next filter, if there is no next filter,then call final handler
-// if there is no chains, filterChain will be recycle to pool
-// if chain is not continue to last, chain will not be recycled
 func (chain *filterChain) handleChain(req Request, resp Response) {
 	filters := chain.filters
 	if len(filters) == 0 {
 		chain.handler(req, resp)
-		chain.destroy()
 	} else {
 		filter := filters[0]
 		chain.filters = filters[1:]
@@ -136,11 +130,12 @@ func (chain *filterChain) handleChain(req Request, resp Response) {
 	}
 }
 
-// destroy destroy all reference hold by filterChain, then recycle it to pool
+// destroy destroy all reference hold by filterChain, filterChain is owned by
+// requestEnv, so it's always destroyed after request processed, even filter
+// don't continue the chain or there is a panic
 func (chain *filterChain) destroy() {
 	chain.filters = nil
 	chain.handler = nil
-	Pool.recycleFilterChain(chain)
 }
 
 // InterceptHandler will create a permanent HandlerFunc/FilterChain, there is no
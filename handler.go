@@ -1,5 +1,10 @@
 package zerver
 
+import (
+	"sort"
+	"strings"
+)
+
 type (
 	// HandlerFunc is the common request handler function type
 	HandlerFunc func(Request, Response)
@@ -9,6 +14,9 @@ type (
 	// and use it's method to process income request
 	// if want to custom the relation of method and handler, just embed
 	// EmptyHandler to your Handler, then implement interface MethodIndicator
+	// HEAD is served by Get with response body discarded, OPTIONS is answered
+	// with an Allow header automaticly, implement MethodLister to leave methods
+	// inherited from EmptyHandler out of it
 	Handler interface {
 		ServerInitializer
 		Destroy()
@@ -35,6 +43,14 @@ type (
 		Handler(method string) HandlerFunc
 	}
 
+	// MethodLister is an optional interface for Handler which embed
+	// EmptyHandler and only implement part of standard methods, it list the
+	// implemented methods, only they are listed in Allow header. HEAD is listed
+	// with GET, OPTIONS is always listed
+	MethodLister interface {
+		Methods() []string
+	}
+
 	// EmptyHandler is an empty handler for user to embed
 	EmptyHandler struct{}
 
@@ -50,16 +66,96 @@ type (
 	}
 )
 
-// indicateHandler indicate handler function from a handler and method
+// methods is the well-known methods, methods of handler are listed by this order
+var methods = []string{GET, HEAD, POST, DELETE, PUT, PATCH, OPTIONS}
+
+// indicateHandler indicate handler function from a handler and method.
+// If handler don't support HEAD, the GET handler function is used, if don't
+// support OPTIONS, a function which report the allowed methods is used
 func indicateHandler(method string, handler Handler) HandlerFunc {
-	switch handler := handler.(type) {
+	handlerFunc := indicate(method, handler)
+	if handlerFunc == nil {
+		switch method {
+		case HEAD:
+			handlerFunc = indicate(GET, handler)
+		case OPTIONS:
+			handlerFunc = func(_ Request, resp Response) {
+				resp.SetHeader(HEADER_ALLOW, allowedMethods(handler))
+			}
+		}
+	}
+	return handlerFunc
+}
+
+// indicate indicate handler function only from handler itself
+func indicate(method string, handler Handler) HandlerFunc {
+	switch h := handler.(type) {
 	case MethodIndicator:
-		return handler.Handler(method)
+		return h.Handler(method)
 	default:
 		return standardIndicate(method, handler)
 	}
 }
 
+// allowedMethods return all methods can be served for handler, seperated by ", ".
+// For MethodLister, only listed methods are considered supported
+func allowedMethods(handler Handler) string {
+	return strings.Join(handlerMethods(handler, indicateHandler), ", ")
+}
+
+// handlerMethods return methods which indicate function return non-nil handler
+// function for. For funcHandler, the methods not well-known are also included
+func handlerMethods(handler Handler, indicate func(string, Handler) HandlerFunc) []string {
+	var listed []string
+	lister, isLister := handler.(MethodLister)
+	if isLister {
+		listed = lister.Methods()
+	}
+	ms := make([]string, 0, len(methods))
+	for _, m := range methods {
+		if indicate(m, handler) != nil && (!isLister || listsMethod(listed, m)) {
+			ms = append(ms, m)
+		}
+	}
+	if fh, is := handler.(*funcHandler); is {
+		start := len(ms)
+		for m, fn := range fh.handlers {
+			if fn != nil && !isWellKnownMethod(m) {
+				ms = append(ms, m)
+			}
+		}
+		sort.Strings(ms[start:])
+	}
+	return ms
+}
+
+// listsMethod check whether method is listed by MethodLister, HEAD is listed
+// with GET, OPTIONS is always listed
+func listsMethod(listed []string, method string) bool {
+	switch method {
+	case OPTIONS:
+		return true
+	case HEAD:
+		return listsMethod(listed, GET)
+	}
+	for _, m := range listed {
+		if parseRequestMethod(m) == method {
+			return true
+		}
+	}
+	return false
+}
+
+// isWellKnownMethod check whether method is one of methods
+func isWellKnownMethod(method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
 // standardIndicate normally indicate method handle function
 // each method indicate the function with same name, such as GET->Get...
 func standardIndicate(method string, handler Handler) HandlerFunc {
@@ -105,6 +201,15 @@ func (fh *funcHandler) Handler(method string) (handlerFunc HandlerFunc) {
 	return fh.handlers[method]
 }
 
+// clone copy funcHandler with all method handlers
+func (fh *funcHandler) clone() *funcHandler {
+	n := newFuncHandler()
+	for method, handler := range fh.handlers {
+		n.handlers[method] = handler
+	}
+	return n
+}
+
 // setMethodHandler setup method handler for funcHandler
 func (fh *funcHandler) setMethodHandler(method string, handlerFunc HandlerFunc) {
 	fh.handlers[method] = handlerFunc
@@ -7,16 +7,17 @@ import (
 )
 
 type requestEnv struct {
-	req  request
-	resp response
+	req        request
+	resp       response
+	rootChain  filterChain // chain of root filters
+	routeChain filterChain // chain of route filters and handler
 }
 
 type ServerPool struct {
-	requestEnvPool  sync.Pool
-	varIndexerPool  sync.Pool
-	filtersPool     sync.Pool
-	filterChainPool sync.Pool
-	otherPools      map[string]*sync.Pool
+	requestEnvPool sync.Pool
+	varIndexerPool sync.Pool
+	filtersPool    sync.Pool
+	otherPools     map[string]*sync.Pool
 }
 
 var Pool *ServerPool
@@ -34,9 +35,6 @@ func init() {
 	Pool.filtersPool.New = func() interface{} {
 		return make([]Filter, 0, FilterCount)
 	}
-	Pool.filterChainPool.New = func() interface{} {
-		return new(filterChain)
-	}
 }
 
 func (pool *ServerPool) ReigisterPool(name string, newFunc func() interface{}) error {
@@ -64,10 +62,6 @@ func (pool *ServerPool) newFilters() []Filter {
 	return pool.filtersPool.Get().([]Filter)
 }
 
-func (pool *ServerPool) newFilterChain() *filterChain {
-	return pool.filterChainPool.Get().(*filterChain)
-}
-
 func (pool *ServerPool) recycleRequestEnv(req *requestEnv) {
 	pool.requestEnvPool.Put(req)
 }
@@ -83,10 +77,6 @@ func (pool *ServerPool) recycleFilters(filters []Filter) {
 	}
 }
 
-func (pool *ServerPool) recycleFilterChain(chain *filterChain) {
-	pool.filterChainPool.Put(chain)
-}
-
 func (pool *ServerPool) RecycleTo(name string, value interface{}) {
 	pool.otherPools[name].Put(value)
 }
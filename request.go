@@ -1,10 +1,16 @@
 package zerver
 
 import (
+	"context"
+	"errors"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strings"
+
+	. "github.com/cosiner/golib/errors"
 )
 
 type (
@@ -19,9 +25,38 @@ type (
 		ContentType() string
 		AcceptEncodings() string
 		Header(name string) string
+		// ParseForm parse urlencoded or multipart form of request body, it's
+		// called by form accessors automaticly, call it to get the parse error
+		ParseForm() error
+		// FormValue return the first value of form field, url query is not
+		// included, use Param for it
+		FormValue(name string) string
+		FormValues(name string) []string
+		// FormFile open the first uploaded file of form field
+		FormFile(name string) (multipart.File, *multipart.FileHeader, error)
+		// FormFiles return metadata of all uploaded files of form field
+		FormFiles(name string) []*multipart.FileHeader
+		// Bind decode request into struct by tags and validate it, see
+		// request.Bind for details
+		Bind(dst interface{}) error
+		// Context return context of request, it's canceled when client's
+		// connection closed or request finished
+		Context() context.Context
+		// WithContext replace context of request, filters can use it to attach
+		// values or deadlines, downstream filters and handler will see the
+		// new context
+		WithContext(ctx context.Context)
+		// Raw return the underlying *http.Request, it's useful for libraries
+		// speak net/http
+		Raw() *http.Request
 		AttrContainer
-		// Cookie(name string) string
-		// SecureCookie(name string) string
+		Cookie(name string) string
+		// SignedCookie return value of cookie signed by Server.CookieCodec,
+		// ErrCookieInvalid is returned if it's tampered
+		SignedCookie(name string) (string, error)
+		// SecureCookie return value of cookie encrypted by Server.CookieCodec,
+		// ErrCookieInvalid is returned if it's tampered
+		SecureCookie(name string) (string, error)
 		serverGetter
 		io.Reader
 		URLVarIndexer
@@ -33,17 +68,36 @@ type (
 		URLVarIndexer
 		serverGetter
 		request *http.Request
+		w       http.ResponseWriter // used to limit size of request body
 		method  string
 		header  http.Header
 		params  url.Values
 		AttrContainer
+
+		bodyLimited bool
+		formParsed  bool
+		formErr     error
+		form        url.Values
+		multipart   *multipart.Form // temporary files are removed on destroy
 	}
 )
 
+const (
+	// DefaultFormMemory is the default memory limit of multipart form
+	DefaultFormMemory = 32 << 20
+	// DefaultFormMaxSize is the default size limit of request body when parse
+	// form or bind json and xml body
+	DefaultFormMaxSize = 64 << 20
+
+	ErrBodyTooLarge = Err("request body too large")
+	ErrNoFile       = Err("no such file in form")
+)
+
 // newRequest create a new request
-func (req *request) init(s serverGetter, requ *http.Request, varIndexer URLVarIndexer) Request {
+func (req *request) init(s serverGetter, w http.ResponseWriter, requ *http.Request, varIndexer URLVarIndexer) Request {
 	req.serverGetter = s
 	req.request = requ
+	req.w = w
 	req.header = requ.Header
 	req.URLVarIndexer = varIndexer
 	method := requ.Method
@@ -59,11 +113,17 @@ func (req *request) init(s serverGetter, requ *http.Request, varIndexer URLVarIn
 func (req *request) destroy() {
 	req.AttrContainer.Clear()
 	req.request = nil
+	req.w = nil
 	req.serverGetter = nil
 	req.header = nil
 	req.URLVarIndexer.destroySelf() // who owns resource, who releases resource
 	req.URLVarIndexer = nil
 	req.params = nil
+	if req.multipart != nil {
+		req.multipart.RemoveAll()
+	}
+	req.formParsed, req.formErr, req.form, req.multipart = false, nil, nil, nil
+	req.bodyLimited = false
 }
 
 func (req *request) Read(data []byte) (int, error) {
@@ -75,21 +135,6 @@ func (req *request) Method() string {
 	return req.method
 }
 
-// // Cookie return cookie value with given name
-// func (req *request) Cookie(name string) string {
-// 	if c, err := req.request.Cookie(name); err == nil {
-// 		return c.Value
-// 	}
-// 	return ""
-// }
-
-// // SecureCookie return secure cookie, currently it's just call Cookie without
-// // 'Secure', if need this feture, just put an filter before handler
-// // and override this method
-// func (req *request) SecureCookie(name string) (value string) {
-// 	return req.Cookie(name)
-// }
-
 // RemoteAddr return remote address
 func (req *request) RemoteAddr() string {
 	return req.request.RemoteAddr
@@ -125,6 +170,89 @@ func (req *request) Params(name string) []string {
 	return params[name]
 }
 
+// ParseForm parse form of request body, memory and body size are limited by
+// Server.FormMemory and Server.FormMaxSize. Uploaded files exceed the memory
+// limit are stored in temporary files, they are removed when request destroyed
+func (req *request) ParseForm() error {
+	if req.formParsed {
+		return req.formErr
+	}
+	req.formParsed = true
+	var (
+		request = req.request
+		s       = req.Server()
+		err     error
+	)
+	req.limitBody()
+	if typ, _, _ := mime.ParseMediaType(request.Header.Get(HEADER_CONTENTTYPE)); typ == "multipart/form-data" {
+		memory := s.FormMemory
+		if memory <= 0 {
+			memory = DefaultFormMemory
+		}
+		err = request.ParseMultipartForm(memory)
+		req.multipart = request.MultipartForm
+	} else {
+		err = request.ParseForm()
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		err = ErrBodyTooLarge
+	}
+	req.form, req.formErr = request.PostForm, err
+	return err
+}
+
+// limitBody limit the size of request body by Server.FormMaxSize, it's only
+// applied once
+func (req *request) limitBody() {
+	if req.bodyLimited {
+		return
+	}
+	req.bodyLimited = true
+	maxSize := req.Server().FormMaxSize
+	if maxSize == 0 {
+		maxSize = DefaultFormMaxSize
+	}
+	if maxSize > 0 && req.request.Body != nil {
+		req.request.Body = http.MaxBytesReader(req.w, req.request.Body, maxSize)
+	}
+}
+
+// FormValue return the first value of form field
+func (req *request) FormValue(name string) string {
+	if values := req.FormValues(name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// FormValues return all values of form field
+func (req *request) FormValues(name string) []string {
+	req.ParseForm()
+	return req.form[name]
+}
+
+// FormFile open the first uploaded file of form field
+func (req *request) FormFile(name string) (multipart.File, *multipart.FileHeader, error) {
+	if err := req.ParseForm(); err != nil {
+		return nil, nil, err
+	}
+	files := req.FormFiles(name)
+	if len(files) == 0 {
+		return nil, nil, ErrNoFile
+	}
+	f, err := files[0].Open()
+	return f, files[0], err
+}
+
+// FormFiles return metadata of all uploaded files of form field
+func (req *request) FormFiles(name string) []*multipart.FileHeader {
+	if req.ParseForm(); req.multipart == nil {
+		return nil
+	}
+	return req.multipart.File[name]
+}
+
 // UserAgent return user's agent identify
 func (req *request) UserAgent() string {
 	return req.Header(HEADER_USERAGENT)
@@ -139,6 +267,21 @@ func (req *request) AcceptEncodings() string {
 	return req.Header(HEADER_ACCEPTENCODING)
 }
 
+// Context return context of request
+func (req *request) Context() context.Context {
+	return req.request.Context()
+}
+
+// WithContext replace context of request
+func (req *request) WithContext(ctx context.Context) {
+	req.request = req.request.WithContext(ctx)
+}
+
+// Raw return the underlying *http.Request
+func (req *request) Raw() *http.Request {
+	return req.request
+}
+
 // URL return request url
 func (req *request) URL() *url.URL {
 	return req.request.URL
@@ -20,13 +20,20 @@ type (
 		SetContentEncoding(enc string)
 		SetContentType(typ string)
 		SetAdvancedCookie(c *http.Cookie)
+		// SetCookie set cookie with secure defaults, lifetime is by seconds
+		SetCookie(name, value string, lifetime int)
+		// SetScriptCookie is same as SetCookie, but the cookie is not HttpOnly,
+		// so client scripts can read it, such as xsrf token
+		SetScriptCookie(name, value string, lifetime int)
+		// SetSignedCookie set cookie signed by Server.CookieCodec
+		SetSignedCookie(name, value string, lifetime int) error
+		// SetSecureCookie set cookie encrypted by Server.CookieCodec
+		SetSecureCookie(name, value string, lifetime int) error
+		DeleteClientCookie(name string)
 		CacheSeconds(secs int)
 		CacheUntil(*time.Time)
 		NoCache()
 
-		// SetCookie(name, value string, lifetime int)
-		// SetSecureCookie(name, value string, lifetime int)
-		// DeleteClientCookie(name string)
 		Status() int
 		// ReportStatus report status code, it will not immediately write the status
 		// to response, unless response is destroyed or Write was called
@@ -39,6 +46,10 @@ type (
 		// status and header should be performed before Write
 		io.Writer
 
+		// Raw return the underlying http.ResponseWriter, write to it directly will
+		// bypass the status reported by ReportStatus
+		Raw() http.ResponseWriter
+
 		destroy()
 		// Value/SetValue provide a approach to transmit value between filter/handler
 		// there is only one instance, if necessary first save origin value, after
@@ -50,9 +61,12 @@ type (
 	// response represent a response of request to user
 	response struct {
 		http.ResponseWriter
+		serverGetter
+		secure       bool // request is https, cookies should be secure
 		header       http.Header
 		status       int
 		statusWrited bool
+		discardBody  bool // for HEAD request
 		value        interface{}
 	}
 )
@@ -62,8 +76,10 @@ const (
 )
 
 // newResponse create a new response, and set default content type to HTML
-func (resp *response) init(w http.ResponseWriter) Response {
+func (resp *response) init(s serverGetter, w http.ResponseWriter, secure bool) Response {
 	resp.ResponseWriter = w
+	resp.serverGetter = s
+	resp.secure = secure
 	resp.header = w.Header()
 	resp.status = http.StatusOK
 	return resp
@@ -72,12 +88,17 @@ func (resp *response) init(w http.ResponseWriter) Response {
 func (resp *response) destroy() {
 	resp.flushHeader()
 	resp.statusWrited = false
+	resp.discardBody = false
 	resp.ResponseWriter = nil
+	resp.serverGetter = nil
 	resp.header = nil
 }
 
 func (resp *response) Write(data []byte) (int, error) {
 	resp.flushHeader()
+	if resp.discardBody {
+		return len(data), nil
+	}
 	return resp.ResponseWriter.Write(data)
 }
 
@@ -101,10 +122,14 @@ func (resp *response) Status() int {
 	return resp.status
 }
 
-// Hijack hijack response connection
+// Hijack hijack response connection, after that, status will not be written
 func (resp *response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if hijacker, is := resp.ResponseWriter.(http.Hijacker); is {
-		return hijacker.Hijack()
+		conn, rw, err := hijacker.Hijack()
+		if err == nil {
+			resp.statusWrited = true
+		}
+		return conn, rw, err
 	}
 	return nil, nil, ErrHijack
 }
@@ -157,24 +182,10 @@ func (resp *response) SetAdvancedCookie(c *http.Cookie) {
 	resp.AddHeader(HEADER_SETCOOKIE, c.String())
 }
 
-// // SetCookie setup response cookie
-// func (resp *response) SetCookie(name, value string, lifetime int) {
-// 	resp.SetAdvancedCookie(&http.Cookie{
-// 		Name:   name,
-// 		Value:  value,
-// 		MaxAge: lifetime,
-// 	})
-// }
-
-// // SetSecureCookie setup response cookie with secureity
-// func (resp *response) SetSecureCookie(name, value string, lifetime int) {
-// 	resp.SetCookie(name, value, lifetime)
-// }
-
-// // DeleteClientCookie delete user briwser's cookie by name
-// func (resp *response) DeleteClientCookie(name string) {
-// 	resp.SetCookie(name, "", -1)
-// }
+// Raw return the underlying http.ResponseWriter
+func (resp *response) Raw() http.ResponseWriter {
+	return resp.ResponseWriter
+}
 
 func (resp *response) Value() interface{} {
 	return resp.value
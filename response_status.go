@@ -21,6 +21,7 @@ type StatusResponse interface {
 	ReportNotModified()       // 304
 	ReportUseProxy()          // 305
 	ReportTemporaryRedirect() // 307
+	ReportPermanentRedirect() // 308
 
 	ReportBadRequest()                   // 400
 	ReportUnauthorized()                 // 401
@@ -130,6 +131,11 @@ func (resp *response) ReportTemporaryRedirect() {
 	resp.ReportStatus(http.StatusTemporaryRedirect)
 }
 
+//308
+func (resp *response) ReportPermanentRedirect() {
+	resp.ReportStatus(http.StatusPermanentRedirect)
+}
+
 //400
 func (resp *response) ReportBadRequest() {
 	resp.ReportStatus(http.StatusBadRequest)
@@ -2,8 +2,11 @@ package zerver
 
 import (
 	"io"
+	"io/fs"
+	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/cosiner/golib/sys"
 
@@ -16,6 +19,13 @@ type (
 		RouteMatcher
 	}
 
+	// LiveRouter is implemented by routers which accept routes while serving,
+	// server set the initializer before Init, routes added after Init are
+	// inited by it, and it's error is returned by the adding method
+	LiveRouter interface {
+		SetLiveInitializer(initialize func(ServerInitializer) error)
+	}
+
 	RouteStore interface {
 		MethodRouter
 
@@ -24,7 +34,11 @@ type (
 		// Destroy destroy router, also responsible for destroy all handlers and filters
 		Destroy()
 		PrintRouteTree(w io.Writer)
-		Group(prefix string, fn func(Router))
+		// Routes return informations of all routes
+		Routes() []RouteInfo
+		// Group create a group router with prefix, filters are attached to the
+		// prefix, routes of the group and nested groups will go through them
+		Group(prefix string, fn func(Router), filters ...Filter)
 
 		// AddFuncHandler add a function handler, method are defined as constant string
 		AddFuncHandler(pattern string, method string, handler HandlerFunc) error
@@ -32,6 +46,11 @@ type (
 		AddHandler(pattern string, handler Handler) error
 
 		AddOptionHandler(pattern string, o *OptionHandler) error
+		// Mount mount a standard http.Handler to pattern and all sub paths of it,
+		// pattern is stripped from request path
+		Mount(pattern string, handler http.Handler) error
+		// Static serve files of root for prefix and all sub paths of it
+		Static(prefix string, root fs.FS, option StaticOption) error
 		// AddFuncFilter add function filter
 		AddFuncFilter(pattern string, filter FilterFunc) error
 		// AddFilter add a filter
@@ -44,15 +63,43 @@ type (
 		AddFuncTaskHandler(pattern string, handler TaskHandlerFunc) error
 		// AddTaskHandler
 		AddTaskHandler(pattern string, handler TaskHandler) error
+		// SetTimeout set timeout for pattern, like filters, it applies to all
+		// routes start with the pattern unless they have their own timeout
+		SetTimeout(pattern string, timeout time.Duration) error
+		// SetName give a name to pattern, a handler, websocket handler or task
+		// handler must be registered on pattern with same variable names before,
+		// otherwise ErrRouteNotFound is returned. Use NewNamedRouter to name
+		// route at registration. The name is removed with the route
+		SetName(pattern, name string) error
+		// SetMeta attach metadata to pattern, such as required scopes or cache
+		// policy, filters can read it from Request.Meta. Like SetName, the
+		// pattern must be registered before
+		SetMeta(pattern, key string, value interface{}) error
+		// URLFor generate url path for named route with variable name-value pairs
+		URLFor(name string, vars ...string) (string, error)
+		// SetRedirect set which canonical path will be tried and redirected to
+		// when path is not matched
+		SetRedirect(option RedirectOption)
+
+		// RemoveHandler remove handler of pattern, handlers removed after router
+		// inited will be destroyed, it's the same for other removes
+		RemoveHandler(pattern string) error
+		// RemoveFilters remove all filters of pattern
+		RemoveFilters(pattern string) error
+		// RemoveWebSocketHandler remove websocket handler of pattern
+		RemoveWebSocketHandler(pattern string) error
+		// RemoveTaskHandler remove task handler of pattern
+		RemoveTaskHandler(pattern string) error
 	}
 
 	RouteMatcher interface {
 		// MatchHandlerFilters match given url to find all matched filters and final handler
 		MatchHandlerFilters(url *url.URL) (Handler, URLVarIndexer, []Filter)
 		// MatchWebSocketHandler match given url to find a matched websocket handler
-		MatchWebSocketHandler(url *url.URL) (WebSocketHandler, URLVarIndexer)
-		// MatchTaskHandler
-		MatchTaskHandler(url *url.URL) (TaskHandler, URLVarIndexer)
+		// and filters, filters are run before the connection upgraded
+		MatchWebSocketHandler(url *url.URL) (WebSocketHandler, URLVarIndexer, []Filter)
+		// MatchTaskHandler match given url to find a matched task handler and filters
+		MatchTaskHandler(url *url.URL) (TaskHandler, URLVarIndexer, []Filter)
 	}
 
 	MethodRouter interface {
@@ -61,6 +108,8 @@ type (
 		Put(string, HandlerFunc) error
 		Delete(string, HandlerFunc) error
 		Patch(string, HandlerFunc) error
+		// Handle register a function handler for any method, such as PROPFIND
+		Handle(method, pattern string, handlerFunc HandlerFunc) error
 	}
 
 	// handlerProcessor keep handler and url variables of this route
@@ -86,6 +135,9 @@ type (
 		handlerProcessor     *handlerProcessor
 		taskHandlerProcessor *taskHandlerProcessor
 		filters              []Filter
+		timeout              time.Duration
+		pattern              string                 // pattern of first registration
+		meta                 map[string]interface{} // never modified, replaced when set
 	}
 
 	// router is a actual url router, it only process path of url, other section is
@@ -96,6 +148,10 @@ type (
 		childs    []*router       // child routers
 		processor *routeProcessor // processor for current route node
 		noFilter  bool
+		// constraints of all variables in str
+		constraints []constraint
+		names       map[string]*namedRoute // named routes, only used by root
+		redirect    RedirectOption         // only used by root
 	}
 )
 
@@ -115,7 +171,10 @@ const (
 		" or catchall at the same position, " +
 		"this means one of them will nerver be matched, " +
 		"please check your routes")
-	ErrHandlerExist = Err("handler for this route already exist")
+	ErrHandlerExist   = Err("handler for this route already exist")
+	ErrInvalidTimeout = Err("timeout can't be negative")
+	ErrInvalidMethod  = Err("invalid http method")
+	ErrRouteNotFound  = Err("route not found")
 )
 
 // init init handler and filters hold by routeProcessor
@@ -162,11 +221,49 @@ func (rp *routeProcessor) destroy() {
 	}
 }
 
-// NewRouter create a new Router
+// has check whether routeProcessor hold processor of the route kind
+func (rp *routeProcessor) has(kind routeKind) bool {
+	if rp == nil {
+		return false
+	}
+	switch kind {
+	case _ROUTE_WEBSOCKET:
+		return rp.wsHandlerProcessor != nil
+	case _ROUTE_TASK:
+		return rp.taskHandlerProcessor != nil
+	}
+	return rp.handlerProcessor != nil
+}
+
+// isEmpty check whether routeProcessor hold nothing
+func (rp *routeProcessor) isEmpty() bool {
+	return rp.handlerProcessor == nil && rp.wsHandlerProcessor == nil &&
+		rp.taskHandlerProcessor == nil && len(rp.filters) == 0 && rp.timeout == 0 &&
+		len(rp.meta) == 0
+}
+
+// clone copy routeProcessor, function handler is also copied for it will be
+// modified when add function handler for another method
+func (rp *routeProcessor) clone() *routeProcessor {
+	p := *rp
+	if rp.filters != nil {
+		p.filters = append(make([]Filter, 0, len(rp.filters)), rp.filters...)
+	}
+	if hp := rp.handlerProcessor; hp != nil {
+		h := *hp
+		if fh, is := hp.handler.(*funcHandler); is {
+			h.handler = fh.clone()
+		}
+		p.handlerProcessor = &h
+	}
+	return &p
+}
+
+// NewRouter create a new Router, it's safe to add or remove routes while serving
 func NewRouter() Router {
 	rt := new(router)
 	rt.noFilter = true
-	return rt
+	return newSafeRouter(rt)
 }
 
 // Init init all handlers, filters, websocket handlers in route tree
@@ -239,23 +336,41 @@ func (rt *router) Patch(pattern string, handlerFunc HandlerFunc) error {
 	return rt.AddFuncHandler(pattern, PATCH, handlerFunc)
 }
 
-func (rt *router) Group(prefix string, fn func(Router)) {
-	fn(NewGroupRouter(rt, prefix))
+// Handle register a function handler process given method for given pattern
+func (rt *router) Handle(method, pattern string, handlerFunc HandlerFunc) error {
+	return rt.AddFuncHandler(pattern, method, handlerFunc)
 }
 
-// AddFuncHandler add function handler to router for given pattern and method
-func (rt *router) AddFuncHandler(pattern, method string, handler HandlerFunc) (err error) {
-	method = parseRequestMethod(method)
-	if fHandler := _tmpGetFuncHandler(pattern); fHandler == nil {
-		fHandler = newFuncHandler()
-		fHandler.setMethodHandler(method, handler)
-		if err = rt.AddHandler(pattern, fHandler); err == nil {
-			_tmpSetFuncHandler(pattern, fHandler)
+// AddFuncHandler add function handler to router for given pattern and method,
+// function handlers of same pattern are merged into one handler, so it can't be
+// mixed with normal handler
+func (rt *router) AddFuncHandler(pattern, method string, handler HandlerFunc) error {
+	if method = parseRequestMethod(method); !isValidMethod(method) {
+		return ErrInvalidMethod
+	}
+	return rt.addPattern(pattern, func(rp *routeProcessor, pathVars map[string]int) error {
+		hp := rp.handlerProcessor
+		if hp == nil {
+			fHandler := newFuncHandler()
+			fHandler.setMethodHandler(method, handler)
+			rp.handlerProcessor = &handlerProcessor{
+				vars:    pathVars,
+				handler: fHandler,
+			}
+			return nil
+		}
+		fHandler, is := hp.handler.(*funcHandler)
+		if !is {
+			return ErrHandlerExist
+		}
+		for name, index := range pathVars {
+			if i, has := hp.vars[name]; !has || i != index {
+				return ErrConflictPathVar
+			}
 		}
-	} else {
 		fHandler.setMethodHandler(method, handler)
-	}
-	return
+		return nil
+	})
 }
 
 // AddHandler add handler to router for given pattern
@@ -328,13 +443,44 @@ func (rt *router) AddFilter(pattern string, filter Filter) error {
 	})
 }
 
+// SetTimeout set timeout for pattern and all routes start with it
+func (rt *router) SetTimeout(pattern string, timeout time.Duration) error {
+	if timeout < 0 {
+		return ErrInvalidTimeout
+	}
+	rt.noFilter = false
+	return rt.addPattern(pattern, func(rp *routeProcessor, _ map[string]int) error {
+		rp.timeout = timeout
+		return nil
+	})
+}
+
+// SetMeta attach metadata to pattern, the metadata map is copied when set, so
+// it's safe to read it while serving
+func (rt *router) SetMeta(pattern, key string, value interface{}) error {
+	rp, err := rt.findRoute(pattern)
+	if err != nil {
+		return err
+	}
+	meta := make(map[string]interface{}, len(rp.meta)+1)
+	for k, v := range rp.meta {
+		meta[k] = v
+	}
+	meta[key] = value
+	rp.meta = meta
+	return nil
+}
+
 // addPattern compile pattern, extract all variables, and add it to route tree
 // setup by given function
 func (rt *router) addPattern(pattern string, fn func(*routeProcessor, map[string]int) error) error {
 	routePath, pathVars, err := compile(pattern)
 	if err == nil {
 		if r, success := rt.addPath(routePath); success {
-			err = fn(r.routeProcessor(), pathVars)
+			rp := r.routeProcessor()
+			if err = fn(rp, pathVars); err == nil && rp.pattern == "" {
+				rp.pattern, _ = decompileVars(routePath, pathVars)
+			}
 		} else {
 			err = ErrConflictPathVar
 		}
@@ -342,39 +488,30 @@ func (rt *router) addPattern(pattern string, fn func(*routeProcessor, map[string
 	return err
 }
 
-// MatchWebSockethandler match url to find final websocket handler
-func (rt *router) MatchWebSocketHandler(url *url.URL) (WebSocketHandler, URLVarIndexer) {
-	path := url.Path
-	indexer := Pool.newVarIndexer()
-	rt, values := rt.matchOne(path, indexer.values)
-	indexer.values = values
-	if rt != nil {
-		if p := rt.processor; p != nil {
-			if wsp := p.wsHandlerProcessor; wsp != nil {
-				indexer.vars = wsp.vars
-				return wsp.wsHandler, indexer
-			}
-		}
+// MatchWebSockethandler match url to find final websocket handler and filters
+func (rt *router) MatchWebSocketHandler(url *url.URL) (WebSocketHandler, URLVarIndexer, []Filter) {
+	node, indexer, filters := rt.matchRoute(url.Path, _ROUTE_WEBSOCKET)
+	if node != nil {
+		p := node.processor
+		wsp := p.wsHandlerProcessor
+		indexer.setRoute(wsp.vars, p)
+		return wsp.wsHandler, indexer, filters
 	}
-	return nil, indexer
+	Pool.recycleFilters(filters)
+	return nil, indexer, nil
 }
 
-// MatchTaskhandler match url to find final websocket handler
-func (rt *router) MatchTaskHandler(url *url.URL) (TaskHandler, URLVarIndexer) {
-	path := url.Path
-	indexer := Pool.newVarIndexer()
-	rt, values := rt.matchOne(path, indexer.values)
-	indexer.values = values
-	if rt != nil {
-		if p := rt.processor; p != nil {
-			if thp := p.taskHandlerProcessor; thp != nil {
-				indexer.vars = thp.vars
-				return thp.taskHandler, indexer
-			}
-		}
+// MatchTaskhandler match url to find final task handler and filters
+func (rt *router) MatchTaskHandler(url *url.URL) (TaskHandler, URLVarIndexer, []Filter) {
+	node, indexer, filters := rt.matchRoute(url.Path, _ROUTE_TASK)
+	if node != nil {
+		p := node.processor
+		thp := p.taskHandlerProcessor
+		indexer.setRoute(thp.vars, p)
+		return thp.taskHandler, indexer, filters
 	}
-	return nil, indexer
-
+	Pool.recycleFilters(filters)
+	return nil, indexer, nil
 }
 
 // // MatchHandler match url to find final websocket handler
@@ -392,40 +529,145 @@ func (rt *router) MatchTaskHandler(url *url.URL) (TaskHandler, URLVarIndexer) {
 // 	return
 // }
 
-// MatchHandlerFilters match url to fin final handler and each filters
+// MatchHandlerFilters match url to fin final handler and each filters, if not
+// matched and the canonical path is matched, a handler redirect to it is
+// returned without filters
 func (rt *router) MatchHandlerFilters(url *url.URL) (Handler,
 	URLVarIndexer, []Filter) {
+	node, indexer, filters := rt.matchRoute(url.Path, _ROUTE_HANDLER)
+	if node != nil {
+		p := node.processor
+		hp := p.handlerProcessor
+		indexer.setRoute(hp.vars, p)
+		return hp.handler, indexer, filters
+	}
+	indexer.timeout = 0 // timeout only apply to matched handler
+	if rt.redirect != RedirectNone {
+		if handler := rt.canonicalHandler(url); handler != nil {
+			Pool.recycleFilters(filters)
+			return handler, indexer, nil
+		}
+	}
+	return nil, indexer, filters
+}
+
+// matchRoute match path to find route node has processor of the kind, filters
+// and timeout of passed nodes are also collected unless there is no filter and
+// timeout in tree
+func (rt *router) matchRoute(path string, kind routeKind) (*router, *urlVarIndexer, []Filter) {
 	var (
-		path    = url.Path
-		p       *routeProcessor
 		indexer = Pool.newVarIndexer()
-		values  = indexer.values
-		filters []Filter
+		m       = routeMatch{values: indexer.values, kind: kind}
+		node    *router
 	)
 	if rt.noFilter {
-		rt, values = rt.matchOne(path, indexer.values)
+		node, m.values = rt.matchOne(path, kind, m.values)
 	} else {
-		filters = Pool.newFilters()
-		pathIndex, continu := 0, true
-		for continu {
-			if p = rt.processor; p != nil {
-				if pfs := p.filters; len(pfs) != 0 {
-					filters = append(filters, pfs...)
-				}
-			}
-			pathIndex, values, rt, continu = rt.matchMultiple(path, pathIndex, values)
+		m.filters = Pool.newFilters()
+		node, m = rt.matchMultiple(path, m)
+	}
+	indexer.values, indexer.timeout = m.values, m.timeout
+	return node, indexer, m.filters
+}
+
+// findRoute find the processor of pattern which has handler, websocket handler
+// or task handler registered with same variable names, otherwise return
+// ErrRouteNotFound
+func (rt *router) findRoute(pattern string) (*routeProcessor, error) {
+	routePath, pathVars, err := compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	node := rt.findPath(routePath)
+	if node == nil || node.processor == nil || !node.processor.hasVars(pathVars) {
+		return nil, ErrRouteNotFound
+	}
+	return node.processor, nil
+}
+
+// hasVars check whether there is a handler, websocket handler or task handler
+// registered with the variables
+func (rp *routeProcessor) hasVars(vars map[string]int) bool {
+	return rp.handlerProcessor != nil && sameVars(rp.handlerProcessor.vars, vars) ||
+		rp.wsHandlerProcessor != nil && sameVars(rp.wsHandlerProcessor.vars, vars) ||
+		rp.taskHandlerProcessor != nil && sameVars(rp.taskHandlerProcessor.vars, vars)
+}
+
+// sameVars check whether two variable maps are same
+func sameVars(a, b map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, index := range a {
+		if i, has := b[name]; !has || i != index {
+			return false
 		}
 	}
-	indexer.values = values
-	if rt != nil {
-		if p = rt.processor; p != nil {
-			if hp := p.handlerProcessor; hp != nil {
-				indexer.vars = hp.vars
-				return hp.handler, indexer, filters
+	return true
+}
+
+// removePattern find the route node of pattern, use given function to move
+// what need to be removed from the processor of node to a new processor, if
+// nothing is removed, ErrRouteNotFound is returned
+func (rt *router) removePattern(pattern string, fn func(rp, removed *routeProcessor)) (*routeProcessor, error) {
+	routePath, _, err := compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	node := rt.findPath(routePath)
+	if node == nil || node.processor == nil {
+		return nil, ErrRouteNotFound
+	}
+	removed := new(routeProcessor)
+	if fn(node.processor, removed); removed.isEmpty() {
+		return nil, ErrRouteNotFound
+	}
+	if node.processor.isEmpty() {
+		node.processor = nil
+	}
+	rt.removeNames(routePath)
+	return removed, nil
+}
+
+// findPath find the route node for compiled path exactly
+func (rt *router) findPath(path string) *router {
+	if !strings.HasPrefix(path, rt.str) {
+		return nil
+	}
+	if path = path[len(rt.str):]; path == "" {
+		return rt
+	}
+	if path[0] == _CONSTRAINT_START { // node has no constraint but path has
+		return nil
+	}
+	for i, c := range rt.chars {
+		if c == path[0] {
+			if node := rt.childs[i].findPath(path); node != nil {
+				return node
 			}
 		}
 	}
-	return nil, indexer, filters
+	return nil
+}
+
+// clone copy the whole route tree
+func (rt *router) clone() *router {
+	n := *rt
+	n.chars = append(make([]byte, 0, len(rt.chars)), rt.chars...)
+	n.childs = make([]*router, len(rt.childs))
+	for i, c := range rt.childs {
+		n.childs[i] = c.clone()
+	}
+	if rt.processor != nil {
+		n.processor = rt.processor.clone()
+	}
+	if rt.names != nil {
+		n.names = make(map[string]*namedRoute, len(rt.names))
+		for name, nr := range rt.names {
+			n.names[name] = nr
+		}
+	}
+	return &n
 }
 
 // addPath add an new path to route, use given function to operate the final
@@ -433,24 +675,27 @@ func (rt *router) MatchHandlerFilters(url *url.URL) (Handler,
 func (rt *router) addPath(path string) (*router, bool) {
 	str := rt.str
 	if str == "" && len(rt.chars) == 0 {
-		rt.str = path
+		rt.setStr(path)
 	} else {
 		diff, pathLen, strLen := 0, len(path), len(str)
 		for diff != pathLen && diff != strLen && path[diff] == str[diff] {
 			diff++
 		}
+		// never split a variable token
+		diff = tokenBoundary(str, path, diff)
 		if diff < pathLen {
 			first := path[diff]
 			if diff == strLen {
 				for i, c := range rt.chars {
-					if c == first {
+					if c == first && sameToken(rt.childs[i].str, path[diff:]) {
 						return rt.childs[i].addPath(path[diff:])
 					}
 				}
 			} else { // diff < strLen
 				rt.moveAllToChild(str[diff:], str[:diff])
 			}
-			newNode := &router{str: path[diff:]}
+			newNode := new(router)
+			newNode.setStr(path[diff:])
 			if !rt.addChild(first, newNode) {
 				return nil, false
 			}
@@ -462,31 +707,62 @@ func (rt *router) addPath(path string) (*router, bool) {
 	return rt, true
 }
 
+// setStr setup path section of current node, and parse all constraints in it
+func (rt *router) setStr(str string) {
+	rt.str = str
+	rt.constraints = compileConstraints(str)
+}
+
 // moveAllToChild move all attributes to a new node, and make this new node
 //  as one of it's child
 func (rt *router) moveAllToChild(childStr string, newStr string) {
 	rnCopy := &router{
-		str:       childStr,
 		chars:     rt.chars,
 		childs:    rt.childs,
 		processor: rt.processor,
 	}
+	rnCopy.setStr(childStr)
 	rt.chars, rt.childs, rt.processor = nil, nil, nil
 	rt.addChild(childStr[0], rnCopy)
-	rt.str = newStr
+	rt.setStr(newStr)
+}
+
+// childRank return the match priority of child, static child has the highest
+// priority, then variable with constraint, variable, the last is catch-all
+func childRank(c byte, n *router) int {
+	switch {
+	case c == _REMAINSALL:
+		return 3
+	case c != _WILDCARD:
+		return 0
+	case tokenEnd(n.str, 0) > 1:
+		return 1
+	}
+	return 2
 }
 
-// addChild add an child, all childs is sorted
+// addChild add an child, all childs is sorted by rank and character, there
+// can be several variable childs with different constraints, but catch-all
+// can't appear with any other variable child
 func (rt *router) addChild(b byte, n *router) bool {
 	chars, childs := rt.chars, rt.childs
 	l := len(chars)
-	if l > 0 && chars[l-1] >= _WILDCARD && b >= _WILDCARD {
-		return false
+	if isMarker(b) {
+		for _, c := range chars {
+			if isMarker(c) && (c == _REMAINSALL || b == _REMAINSALL) {
+				return false
+			}
+		}
 	}
 	chars, childs = make([]byte, l+1), make([]*router, l+1)
 	copy(chars, rt.chars)
 	copy(childs, rt.childs)
-	for ; l > 0 && chars[l-1] > b; l-- {
+	rank := childRank(b, n)
+	for ; l > 0; l-- {
+		r := childRank(chars[l-1], childs[l-1])
+		if r < rank || r == rank && (r != 0 || chars[l-1] < b) {
+			break
+		}
 		chars[l], childs[l] = chars[l-1], childs[l-1]
 	}
 	chars[l], childs[l] = b, n
@@ -506,115 +782,210 @@ const (
 	_PRINT_SEP = "-"
 )
 
-// matchMultiple match multi route node
-// returned value:(first:next path start index, second:if continue, it's next node to match,
-// else it's final match node, last:whether continu match)
-func (rt *router) matchMultiple(path string, pathIndex int, values []string) (int,
-	[]string, *router, bool) {
-	str, strIndex := rt.str, 0
-	strLen, pathLen := len(str), len(path)
-	for strIndex < strLen {
-		if pathIndex != pathLen {
-			c := str[strIndex]
-			strIndex++
-			switch c {
-			case path[pathIndex]: // else check character MatchPath or not
-				pathIndex++
-			case _WILDCARD:
-				// if read '*', MatchPath until next '/'
-				start := pathIndex
-				for pathIndex < pathLen && path[pathIndex] != '/' {
-					pathIndex++
-				}
-				values = append(values, path[start:pathIndex])
-			case _REMAINSALL: // parse end, full matched
-				values = append(values, path[pathIndex:pathLen])
-				pathIndex = pathLen
-				strIndex = strLen
-			default:
-				return -1, nil, nil, false // not matched
+// routeKind is the kind of processor a route node hold
+type routeKind uint8
+
+const (
+	_ROUTE_HANDLER routeKind = iota
+	_ROUTE_WEBSOCKET
+	_ROUTE_TASK
+)
+
+// routeMatch keep the state of matching a path, it's passed by value so
+// nothing need to be restored when backtracking
+type routeMatch struct {
+	values  []string
+	filters []Filter
+	timeout time.Duration
+	kind    routeKind // only node has processor of this kind is matched
+	collect bool      // collect filters and timeout of passed nodes
+}
+
+// matchMultiple match route node, collect filters and timeout of all passed
+// nodes into routeMatch
+func (rt *router) matchMultiple(path string, m routeMatch) (*router, routeMatch) {
+	m.collect = true
+	return rt.match(path, 0, m)
+}
+
+// matchOne match one route node has processor of the kind and return values
+// of path variable
+func (rt *router) matchOne(path string, kind routeKind, values []string) (*router, []string) {
+	rt, m := rt.match(path, 0, routeMatch{values: values, kind: kind})
+	return rt, m.values
+}
+
+// match match path from pathIndex with current node and it's childs, static
+// child is tried first, if it's not matched, try variable childs by order.
+// A node is matched only if it has processor of the kind, otherwise the
+// siblings are tried. When not matched, the given routeMatch is returned
+func (rt *router) match(path string, pathIndex int, m routeMatch) (*router, routeMatch) {
+	var (
+		n       = m
+		matched bool
+	)
+	for {
+		if pathIndex, n.values, matched = rt.matchStr(path, pathIndex, n.values); !matched {
+			return nil, m
+		}
+		if p := rt.processor; p != nil && m.collect {
+			if len(p.filters) != 0 {
+				n.filters = appendFilters(n.filters, p.filters, path, pathIndex)
+			}
+			if p.timeout != 0 {
+				n.timeout = p.timeout
 			}
-		} else {
-			return -1, nil, nil, false // path parse end
 		}
-	}
-	var continu bool
-	if pathIndex != pathLen { // path not parse end, to find a child node to continue
-		var node *router
-		p := path[pathIndex]
+		if pathIndex == len(path) {
+			if rt.processor.has(m.kind) {
+				return rt, n
+			}
+			// path may end before an empty catch-all which is splited by
+			// sibling routes, such as /static/ for /static/*file and /static/x
+			if rt = rt.remainsChild(); rt == nil {
+				return nil, m
+			}
+			continue
+		}
+		var (
+			p    = path[pathIndex]
+			next *router
+		)
 		for i, c := range rt.chars {
-			if c == p || c >= _WILDCARD {
-				node = rt.childs[i] // child
-				break
+			if c == p || isMarker(c) {
+				if next != nil { // only recurse when there are other candidates
+					if node, cm := next.match(path, pathIndex, n); node != nil {
+						return node, cm
+					}
+				}
+				next = rt.childs[i]
 			}
 		}
-		rt = node
-		if node != nil {
-			continu = true
+		if next == nil {
+			return nil, m
+		}
+		rt = next
+	}
+}
+
+// appendFilters append filters of node end at pathIndex, group filters are
+// skipped if path continue in the same section
+func appendFilters(filters, nodeFilters []Filter, path string, pathIndex int) []Filter {
+	if pathIndex == len(path) || path[pathIndex] == '/' || path[pathIndex-1] == '/' {
+		return append(filters, nodeFilters...)
+	}
+	for _, f := range nodeFilters {
+		if _, is := f.(groupFilter); !is {
+			filters = append(filters, f)
 		}
 	}
-	return pathIndex, values, rt, continu
+	return filters
 }
 
-// matchOne match one longest route node and return values of path variable
-func (rt *router) matchOne(path string, values []string) (*router, []string) {
+// matchStr match path section of current node, variable values will be
+// appended to values
+func (rt *router) matchStr(path string, pathIndex int, values []string) (int, []string, bool) {
 	var (
-		str                string
-		strIndex, strLen   int
-		pathIndex, pathLen = 0, len(path)
-		node               = rt
+		str             = rt.str
+		strLen, pathLen = len(str), len(path)
+		constraintIndex int
+		matched         bool
 	)
-	for node != nil {
-		str, strIndex = rt.str, 0
-		strLen = len(str)
-		for strIndex < strLen {
-			if pathIndex != pathLen {
-				c := str[strIndex]
-				strIndex++
-				switch c {
-				case path[pathIndex]: // else check character MatchPath or not
-					pathIndex++
-				case _WILDCARD:
-					// if read '*', MatchPath until next '/'
-					start := pathIndex
-					for pathIndex < pathLen && path[pathIndex] != '/' {
-						pathIndex++
-					}
-					values = append(values, path[start:pathIndex])
-				case _REMAINSALL: // parse end, full matched
-					values = append(values, path[pathIndex:pathLen])
-					return rt, values
-				default:
-					return nil, nil // not matched
-				}
-			} else {
-				return nil, nil // path parse end
+	for strIndex := 0; strIndex < strLen; {
+		c := str[strIndex]
+		strIndex++
+		if !isMarker(c) {
+			if pathIndex == pathLen || path[pathIndex] != c {
+				return pathIndex, values, false // not matched or path parse end
 			}
+			pathIndex++
+			continue
 		}
-		node = nil
-		if pathIndex != pathLen { // path not parse end, must find a child node to continue
-			p := path[pathIndex]
-			for i, c := range rt.chars {
-				if c == p || c >= _WILDCARD {
-					node = rt.childs[i] // child
-					break
-				}
+		if pathIndex == pathLen && (c != _REMAINSALL || !rt.emptyRemains()) {
+			return pathIndex, values, false // path parse end
+		}
+		var check constraint
+		if strIndex < strLen && str[strIndex] == _CONSTRAINT_START {
+			strIndex = tokenEnd(str, strIndex-1)
+			check = rt.constraints[constraintIndex]
+			constraintIndex++
+		}
+		start := pathIndex
+		if c == _WILDCARD { // MatchPath until static characters behind or next '/'
+			if pathIndex, matched = varEnd(str, strIndex, path, pathIndex, false); !matched {
+				return pathIndex, values, false
 			}
-			rt = node // child to parse
-		} /* else { path parse end, node is the last matched node }*/
+		} else { // catch all remains
+			pathIndex = pathLen
+		}
+		value := path[start:pathIndex]
+		if check != nil && !check(value) {
+			return pathIndex, values, false
+		}
+		values = append(values, value)
+		if c == _REMAINSALL { // parse end, full matched
+			return pathIndex, values, true
+		}
 	}
-	return rt, values
+	return pathIndex, values, true
 }
 
-// isInvalidSection check whether section has the predefined _WILDCARD and match
-// all character
-func isInvalidSection(s string) bool {
-	for _, c := range s {
-		if bc := byte(c); bc >= _WILDCARD {
-			return true
+// emptyRemains check whether catch-all of node can match empty value, it's only
+// allowed for handlers added by Mount and Static, such as /static/ for
+// /static/*file
+func (rt *router) emptyRemains() bool {
+	if rt.processor == nil || rt.processor.handlerProcessor == nil {
+		return false
+	}
+	_, is := rt.processor.handlerProcessor.handler.(remainsHandler)
+	return is
+}
+
+// remainsChild return the catch-all child of node, it's always the last one
+// for it has the lowest rank
+func (rt *router) remainsChild() *router {
+	if l := len(rt.chars); l != 0 && rt.chars[l-1] == _REMAINSALL {
+		return rt.childs[l-1]
+	}
+	return nil
+}
+
+// varEnd return the end of variable value start at pathIndex, strIndex is the
+// index behind the variable in str. If there are static characters behind the
+// variable in the same section, the value end at the first position they
+// appeared, and the value can't be empty, otherwise end at the section end
+func varEnd(str string, strIndex int, path string, pathIndex int, fold bool) (int, bool) {
+	sectionEnd, pathLen := pathIndex, len(path)
+	for sectionEnd < pathLen && path[sectionEnd] != '/' {
+		sectionEnd++
+	}
+	staticEnd, strLen := strIndex, len(str)
+	for staticEnd < strLen && str[staticEnd] != '/' && !isMarker(str[staticEnd]) {
+		staticEnd++
+	}
+	if staticEnd == strIndex {
+		return sectionEnd, true
+	}
+	static := str[strIndex:staticEnd]
+	for end := pathIndex + 1; end+len(static) <= sectionEnd; end++ {
+		if hasPrefix(path[end:], static, fold) {
+			return end, true
+		}
+	}
+	return pathIndex, false
+}
+
+// hasPrefix check whether s start with prefix, fold means case-insensitive
+func hasPrefix(s, prefix string, fold bool) bool {
+	if !fold {
+		return s[:len(prefix)] == prefix
+	}
+	for i := 0; i < len(prefix); i++ {
+		if !equalFold(s[i], prefix[i]) {
+			return false
 		}
 	}
-	return false
+	return true
 }
 
 // compile compile a url path to a clean path that replace all named variable
@@ -623,6 +994,16 @@ func isInvalidSection(s string) bool {
 // for ':', it will catch the single section of url path seperated by '/'
 // for '*', it will catch all remains url path, it should appear in the last
 // of pattern for variables behind it will all be ignored
+//
+// variable name is consist of letters, digits and '_', a section can have
+// several variables and static characters, such as /:name.:ext, /v:version,
+// /img/:w x :h.png, the value of ':' variable end at the static characters
+// behind it, so variables must be seperated by static characters
+//
+// variable can have a constraint surrounded by '<' and '>' behind it's name,
+// it's a builtin constraint such as int, uint, alpha, uuid, or a regular
+// expression which must match whole value, such as :id<int>, :slug<[a-z-]+>,
+// the constraint is kept in compiled path
 func compile(path string) (newPath string, vars map[string]int, err error) {
 	path = strings.TrimSpace(path)
 	l := len(path)
@@ -630,57 +1011,81 @@ func compile(path string) (newPath string, vars map[string]int, err error) {
 		return "", nil, Errorf("Invalid url pattern: %s, must start with '/'", path)
 	}
 	if l != 1 && path[l-1] == '/' {
-		path = path[:l-1]
-	}
-	sections := strings.Split(path[1:], "/")
-	new := make([]byte, 0, len(path))
-	varIndex := 0
-	for _, s := range sections {
-		new = append(new, '/')
-		last := len(s)
-		i := last - 1
-		var c byte
-		for ; i >= 0; i-- {
-			if s[i] == _MATCH_WILDCARD {
-				c = _WILDCARD
-			} else if s[i] == _MATCH_REMAINSALL {
-				c = _REMAINSALL
-			} else {
-				continue
+		path, l = path[:l-1], l-1
+	}
+	var (
+		new      = make([]byte, 0, l)
+		varIndex int
+		afterVar bool
+	)
+	for i := 0; i < l; {
+		c := path[i]
+		if c != _MATCH_WILDCARD && c != _MATCH_REMAINSALL {
+			if isMarker(c) {
+				return "", nil, Errorf("path %s has pre-defined characters %c or %c",
+					path, _WILDCARD, _REMAINSALL)
 			}
-			if name := s[i+1:]; len(name) > 0 {
-				if isInvalidSection(name) {
-					goto ERROR
-				}
-				if vars == nil {
-					vars = make(map[string]int)
-				}
-				vars[name] = varIndex
+			new = append(new, c)
+			i, afterVar = i+1, false
+			continue
+		}
+		if afterVar {
+			return "", nil, Errorf("variables of %s must be seperated by static characters", path)
+		}
+		end := i + 1
+		for end < l && isVarNameChar(path[end]) {
+			end++
+		}
+		if name := path[i+1 : end]; name != "" {
+			if vars == nil {
+				vars = make(map[string]int)
 			}
-			varIndex++
-			last = i
-			break
+			vars[name] = varIndex
 		}
-		if last != 0 {
-			new = append(new, []byte(s[:last])...)
+		varIndex++
+		if c == _MATCH_WILDCARD {
+			new = append(new, _WILDCARD)
+		} else {
+			new = append(new, _REMAINSALL)
 		}
-		if c != 0 {
-			new = append(new, c)
+		if end < l && path[end] == _CONSTRAINT_START {
+			start := end
+			if end = constraintEnd(path, start); end < 0 {
+				return "", nil, Errorf("Invalid constraint of %s: missing %c", path, _CONSTRAINT_END)
+			}
+			spec := path[start+1 : end-1]
+			if _, err = parseConstraint(spec); err != nil {
+				return "", nil, Errorf("Invalid constraint %s of %s: %s", spec, path, err.Error())
+			}
+			new = append(new, path[start:end]...)
+		}
+		if c == _MATCH_REMAINSALL && end < l && path[end] != '/' {
+			return "", nil, Errorf("catch-all variable of %s must be the end of section", path)
 		}
+		i, afterVar = end, true
 	}
 	newPath = string(new)
 	if vars == nil {
 		vars = nilVars
 	}
 	return
-ERROR:
-	return "", nil,
-		Errorf("path %s has pre-defined characters %c or %c",
-			path, _WILDCARD, _REMAINSALL)
+}
+
+// decompile convert compiled path back to pattern, variable names are omitted
+func decompile(str string) string {
+	s := []byte(str)
+	for i := 0; i < len(s); i = tokenEnd(str, i) {
+		if s[i] == _WILDCARD {
+			s[i] = _MATCH_WILDCARD
+		} else if s[i] == _REMAINSALL {
+			s[i] = _MATCH_REMAINSALL
+		}
+	}
+	return string(s)
 }
 
 // PrintRouteTree print an route tree
-// every level will be seperated by "-"
+// every level will be seperated by "-", methods of handler are listed behind
 func (rt *router) PrintRouteTree(w io.Writer) {
 	rt.printRouteTree(w, "")
 }
@@ -690,16 +1095,13 @@ func (rt *router) printRouteTree(w io.Writer, parentPath string) {
 	if parentPath != "" {
 		parentPath = parentPath + _PRINT_SEP
 	}
-	s := []byte(rt.str)
-	for i := range s {
-		if s[i] == _WILDCARD {
-			s[i] = _MATCH_WILDCARD
-		} else if s[i] == _REMAINSALL {
-			s[i] = _MATCH_REMAINSALL
-		}
+	cur := parentPath + decompile(rt.str)
+	line := cur
+	if p := rt.processor; p != nil && p.handlerProcessor != nil {
+		ms := handlerMethods(p.handlerProcessor.handler, indicate)
+		line += " [" + strings.Join(ms, ", ") + "]"
 	}
-	cur := parentPath + string(s)
-	if _, e := sys.WriteStrln(w, cur); e == nil {
+	if _, e := sys.WriteStrln(w, line); e == nil {
 		rt.accessAllChilds(func(n *router) bool {
 			n.printRouteTree(w, cur)
 			return true
@@ -715,15 +1117,3 @@ func (rt *router) accessAllChilds(fn func(*router) bool) {
 		}
 	}
 }
-
-func _tmpGetFuncHandler(pattern string) *funcHandler {
-	h := TmpHGet("funcHandlers", pattern)
-	if h == nil {
-		return nil
-	}
-	return h.(*funcHandler)
-}
-
-func _tmpSetFuncHandler(pattern string, handler *funcHandler) {
-	TmpHSet("funcHandlers", pattern, handler)
-}
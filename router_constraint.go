@@ -0,0 +1,198 @@
+package zerver
+
+import (
+	"regexp"
+	"sync"
+
+	. "github.com/cosiner/golib/errors"
+)
+
+// constraint check whether the value of url variable is valid
+type constraint func(value string) bool
+
+const (
+	// _CONSTRAINT_START and _CONSTRAINT_END surround the constraint of variable,
+	// in compiled path, they only appear just behind _WILDCARD or _REMAINSALL
+	_CONSTRAINT_START = '<'
+	_CONSTRAINT_END   = '>'
+)
+
+var (
+	// builtinConstraints is the constraints can be used by name
+	builtinConstraints = map[string]constraint{
+		"int":   isInt,
+		"uint":  isUint,
+		"alpha": isAlpha,
+		"uuid":  isUUID,
+	}
+
+	// constraints cache all constraints used by routes, regexp constraints will be
+	// compiled only once
+	constraints = struct {
+		sync.Mutex
+		m map[string]constraint
+	}{m: make(map[string]constraint)}
+)
+
+// parseConstraint return constraint for spec, spec is a builtin constraint name
+// or a regular expression, which must match whole value
+func parseConstraint(spec string) (constraint, error) {
+	if spec == "" {
+		return nil, Err("empty constraint")
+	}
+	constraints.Lock()
+	defer constraints.Unlock()
+	if c, has := constraints.m[spec]; has {
+		return c, nil
+	}
+	c, has := builtinConstraints[spec]
+	if !has {
+		reg, err := regexp.Compile("^(?:" + spec + ")$")
+		if err != nil {
+			return nil, err
+		}
+		c = reg.MatchString
+	}
+	constraints.m[spec] = c
+	return c, nil
+}
+
+// isMarker check whether character is _WILDCARD or _REMAINSALL
+func isMarker(c byte) bool {
+	return c == _WILDCARD || c == _REMAINSALL
+}
+
+// tokenEnd return the end index of the token start at index, for variable
+// token, it contains the marker and constraint, otherwise only one character
+func tokenEnd(str string, index int) int {
+	end := index + 1
+	if isMarker(str[index]) && end < len(str) && str[end] == _CONSTRAINT_START {
+		end = constraintEnd(str, end)
+	}
+	return end
+}
+
+// constraintEnd return the index behind the _CONSTRAINT_END matched the
+// _CONSTRAINT_START at start, constraint can contains paired '<' and '>' such
+// as (?P<name>re), if not found, return -1
+func constraintEnd(str string, start int) int {
+	depth := 0
+	for i := start; i < len(str); i++ {
+		switch str[i] {
+		case _CONSTRAINT_START:
+			depth++
+		case _CONSTRAINT_END:
+			if depth--; depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// unitEnd return the end index of the unit start at index, for variable, the
+// unit contains it and all characters behind it in the same section, they will
+// never be split to different route node, otherwise only one character
+func unitEnd(str string, index int) int {
+	if !isMarker(str[index]) {
+		return index + 1
+	}
+	end := tokenEnd(str, index)
+	for end < len(str) && str[end] != '/' {
+		end = tokenEnd(str, end)
+	}
+	return end
+}
+
+// tokenBoundary move diff, the common prefix length of two compiled path, back
+// to a position which is not inside a variable unit of either path
+func tokenBoundary(s1, s2 string, diff int) int {
+	for i := 0; i < diff; {
+		if !isMarker(s1[i]) {
+			i++
+			continue
+		}
+		e1, e2 := unitEnd(s1, i), unitEnd(s2, i)
+		if diff < e1 || diff < e2 {
+			return i
+		}
+		i = e1
+	}
+	return diff
+}
+
+// sameToken check whether two compiled path start with same unit
+func sameToken(s1, s2 string) bool {
+	e1, e2 := unitEnd(s1, 0), unitEnd(s2, 0)
+	return e1 == e2 && s1[:e1] == s2[:e2]
+}
+
+// isVarNameChar check whether character can be used in variable name
+func isVarNameChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_'
+}
+
+// compileConstraints parse all constraints in str by order
+func compileConstraints(str string) []constraint {
+	var cs []constraint
+	for i := 0; i < len(str); {
+		end := tokenEnd(str, i)
+		if end-i > 1 {
+			c, _ := parseConstraint(str[i+2 : end-1]) // already checked by compile
+			cs = append(cs, c)
+		}
+		i = end
+	}
+	return cs
+}
+
+func isUint(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isInt(s string) bool {
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+	return isUint(s)
+}
+
+func isAlpha(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i] | 0x20; c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c|0x20 && c|0x20 <= 'f') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -1,82 +1,235 @@
 package zerver
 
-type groupRouter struct {
-	prefix string
-	Router
+import (
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	groupRouter struct {
+		prefix  string
+		filters []Filter
+		// filters is added to the prefix when first route is added to group,
+		// err is the error occurred
+		once sync.Once
+		err  error
+		Router
+	}
+
+	// groupFilter is filter of group, it's only applied to the prefix of group
+	// and it's sub paths, but not paths share the same string prefix, such as
+	// "/administrators" for group "/admin"
+	groupFilter struct {
+		filter Filter
+	}
+)
+
+func (f groupFilter) Init(s *Server) error { return f.filter.Init(s) }
+func (f groupFilter) Destroy()             { f.filter.Destroy() }
+func (f groupFilter) Filter(req Request, resp Response, chain FilterChain) {
+	f.filter.Filter(req, resp, chain)
 }
 
-func NewGroupRouter(rt Router, prefix string) Router {
+// NewGroupRouter create a group router, all routes added to it start with
+// prefix, filters are attached to prefix, routes of the group and nested
+// groups, includes websocket and task handlers, will go through them. Paths
+// only share the string prefix, such as "/administrators" for "/admin", are
+// not affected
+func NewGroupRouter(rt Router, prefix string, filters ...Filter) Router {
 	return &groupRouter{
-		prefix: prefix,
-		Router: rt,
+		prefix:  prefix,
+		filters: filters,
+		Router:  rt,
 	}
 }
 
+// addFilters add filters of group to parent router, it's only done once
+func (gr *groupRouter) addFilters() error {
+	gr.once.Do(func() {
+		pattern := gr.prefix
+		if pattern == "" {
+			pattern = "/"
+		}
+		for _, filter := range gr.filters {
+			if gr.err = gr.Router.AddFilter(pattern, groupFilter{filter}); gr.err != nil {
+				return
+			}
+		}
+	})
+	return gr.err
+}
+
+// Group create a nested group, it's prefix and filters is appended to current
+// group
+func (gr *groupRouter) Group(prefix string, fn func(Router), filters ...Filter) {
+	fn(NewGroupRouter(gr, prefix, filters...))
+}
+
 // AddFuncHandler add a function handler, method are defined as constant string
 func (gr *groupRouter) AddFuncHandler(pattern string, method string, handler HandlerFunc) error {
+	if err := gr.addFilters(); err != nil {
+		return err
+	}
 	return gr.Router.AddFuncHandler(gr.prefix+pattern, method, handler)
 }
 
 // AddHandler add a handler
 func (gr *groupRouter) AddHandler(pattern string, handler Handler) error {
+	if err := gr.addFilters(); err != nil {
+		return err
+	}
 	return gr.Router.AddHandler(gr.prefix+pattern, handler)
 }
 
 func (gr *groupRouter) AddOptionHandler(pattern string, o *OptionHandler) error {
-	return gr.Router.AddOptionHandler(gr.prefix+pattern, o)
+	return gr.AddHandler(pattern, newFuncHandlerFrom(o))
+}
+
+// Mount mount a standard http.Handler to pattern with group prefix
+func (gr *groupRouter) Mount(pattern string, handler http.Handler) error {
+	if err := gr.addFilters(); err != nil {
+		return err
+	}
+	return gr.Router.Mount(gr.prefix+pattern, handler)
+}
+
+// Static serve files of root for prefix with group prefix
+func (gr *groupRouter) Static(prefix string, root fs.FS, option StaticOption) error {
+	if err := gr.addFilters(); err != nil {
+		return err
+	}
+	return gr.Router.Static(gr.prefix+prefix, root, option)
 }
 
 // AddFuncFilter add function filter
 func (gr *groupRouter) AddFuncFilter(pattern string, filter FilterFunc) error {
-	return gr.Router.AddFuncFilter(gr.prefix+pattern, filter)
+	return gr.AddFilter(pattern, filter)
 }
 
-// AddFilter add a filter
+// AddFilter add a filter, it's run after filters of group
 func (gr *groupRouter) AddFilter(pattern string, filter Filter) error {
+	if err := gr.addFilters(); err != nil {
+		return err
+	}
 	return gr.Router.AddFilter(gr.prefix+pattern, filter)
 }
 
 // AddFuncWebSocketHandler add a websocket functionhandler
 func (gr *groupRouter) AddFuncWebSocketHandler(pattern string, handler WebSocketHandlerFunc) error {
-	return gr.Router.AddFuncWebSocketHandler(gr.prefix+pattern, handler)
+	return gr.AddWebSocketHandler(pattern, handler)
 }
 
 // AddWebSocketHandler add a websocket handler
 func (gr *groupRouter) AddWebSocketHandler(pattern string, handler WebSocketHandler) error {
+	if err := gr.addFilters(); err != nil {
+		return err
+	}
 	return gr.Router.AddWebSocketHandler(gr.prefix+pattern, handler)
 }
 
 // AddFuncTaskHandler
 func (gr *groupRouter) AddFuncTaskHandler(pattern string, handler TaskHandlerFunc) error {
-	return gr.Router.AddFuncTaskHandler(gr.prefix+pattern, handler)
+	return gr.AddTaskHandler(pattern, handler)
 }
 
 // AddTaskHandler
 func (gr *groupRouter) AddTaskHandler(pattern string, handler TaskHandler) error {
+	if err := gr.addFilters(); err != nil {
+		return err
+	}
 	return gr.Router.AddTaskHandler(gr.prefix+pattern, handler)
 }
 
+// SetTimeout set timeout for pattern, use "" for whole group
+func (gr *groupRouter) SetTimeout(pattern string, timeout time.Duration) error {
+	return gr.Router.SetTimeout(gr.prefix+pattern, timeout)
+}
+
+// SetName give a name to pattern with group prefix
+func (gr *groupRouter) SetName(pattern, name string) error {
+	return gr.Router.SetName(gr.prefix+pattern, name)
+}
+
+// SetMeta attach metadata to pattern with group prefix
+func (gr *groupRouter) SetMeta(pattern, key string, value interface{}) error {
+	return gr.Router.SetMeta(gr.prefix+pattern, key, value)
+}
+
 // Get register a function handler process GET request for given pattern
 func (gr *groupRouter) Get(pattern string, handlerFunc HandlerFunc) error {
-	return gr.Router.Get(gr.prefix+pattern, handlerFunc)
+	return gr.AddFuncHandler(pattern, GET, handlerFunc)
 }
 
 // Post register a function handler process POST request for given pattern
 func (gr *groupRouter) Post(pattern string, handlerFunc HandlerFunc) error {
-	return gr.Router.Post(gr.prefix+pattern, handlerFunc)
+	return gr.AddFuncHandler(pattern, POST, handlerFunc)
 }
 
 // Put register a function handler process PUT request for given pattern
 func (gr *groupRouter) Put(pattern string, handlerFunc HandlerFunc) error {
-	return gr.Router.Put(gr.prefix+pattern, handlerFunc)
+	return gr.AddFuncHandler(pattern, PUT, handlerFunc)
 }
 
 // Delete register a function handler process DELETE request for given pattern
 func (gr *groupRouter) Delete(pattern string, handlerFunc HandlerFunc) error {
-	return gr.Router.Delete(gr.prefix+pattern, handlerFunc)
+	return gr.AddFuncHandler(pattern, DELETE, handlerFunc)
 }
 
 // Patch register a function handler process PATCH request for given pattern
 func (gr *groupRouter) Patch(pattern string, handlerFunc HandlerFunc) error {
-	return gr.Router.Patch(gr.prefix+pattern, handlerFunc)
+	return gr.AddFuncHandler(pattern, PATCH, handlerFunc)
+}
+
+// Handle register a function handler process given method for given pattern
+func (gr *groupRouter) Handle(method, pattern string, handlerFunc HandlerFunc) error {
+	return gr.AddFuncHandler(pattern, method, handlerFunc)
+}
+
+// Routes return informations of routes start with group prefix
+func (gr *groupRouter) Routes() []RouteInfo {
+	prefix, rt := gr.prefix, gr.Router
+	for {
+		g, is := rt.(*groupRouter)
+		if !is {
+			break
+		}
+		prefix, rt = g.prefix+prefix, g.Router
+	}
+	routes := rt.Routes()
+	path, _, err := compile(prefix)
+	if err != nil {
+		return routes
+	}
+	// same as groupFilter, prefix must end at a section boundary
+	groupRoutes := routes[:0]
+	for _, r := range routes {
+		if strings.HasPrefix(r.path, path) && (len(r.path) == len(path) ||
+			r.path[len(path)] == '/' || strings.HasSuffix(path, "/")) {
+			groupRoutes = append(groupRoutes, r)
+		}
+	}
+	return groupRoutes
+}
+
+// RemoveHandler remove handler of pattern with group prefix
+func (gr *groupRouter) RemoveHandler(pattern string) error {
+	return gr.Router.RemoveHandler(gr.prefix + pattern)
+}
+
+// RemoveFilters remove all filters of pattern with group prefix
+func (gr *groupRouter) RemoveFilters(pattern string) error {
+	return gr.Router.RemoveFilters(gr.prefix + pattern)
+}
+
+// RemoveWebSocketHandler remove websocket handler of pattern with group prefix
+func (gr *groupRouter) RemoveWebSocketHandler(pattern string) error {
+	return gr.Router.RemoveWebSocketHandler(gr.prefix + pattern)
+}
+
+// RemoveTaskHandler remove task handler of pattern with group prefix
+func (gr *groupRouter) RemoveTaskHandler(pattern string) error {
+	return gr.Router.RemoveTaskHandler(gr.prefix + pattern)
 }
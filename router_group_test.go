@@ -1,6 +1,8 @@
 package zerver
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"testing"
@@ -32,3 +34,77 @@ func BenchmarkRouter(b *testing.B) {
 		_, _, _ = grt.MatchHandlerFilters(u)
 	}
 }
+
+func TestGroupRoutes(t *testing.T) {
+	tt := test.WrapTest(t)
+	r := NewRouter()
+	r.Get("/", EmptyHandlerFunc)
+	gr := NewGroupRouter(r, "/user")
+	gr.Get("/:id", EmptyHandlerFunc)
+	gr.Post("/:id/exist", EmptyHandlerFunc)
+	routes := gr.Routes()
+	tt.AssertEq(len(routes), 2)
+	tt.AssertEq(routes[0].Pattern, "/user/:id")
+	tt.AssertEq(routes[1].Pattern, "/user/:id/exist")
+	tt.AssertEq(len(r.Routes()), 3)
+
+	// sibling group share the prefix but not the section
+	NewGroupRouter(r, "/users").Get("/:id", EmptyHandlerFunc)
+	tt.AssertEq(len(gr.Routes()), 2)
+	tt.AssertEq(len(NewGroupRouter(r, "/users").Routes()), 1)
+	tt.AssertEq(len(NewGroupRouter(r, "/").Routes()), 4)
+}
+
+// traceFilter append it's name to response header, it continue the chain only
+// if request has no header "Deny" equal to it's name
+type traceFilter string
+
+func (f traceFilter) Init(*Server) error { return nil }
+func (f traceFilter) Destroy()           {}
+func (f traceFilter) Filter(req Request, resp Response, chain FilterChain) {
+	resp.AddHeader("X-Trace", string(f))
+	if req.Header("Deny") == string(f) {
+		resp.ReportForbidden()
+		return
+	}
+	chain(req, resp)
+}
+
+func TestGroupFilters(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	s.Group("/admin", func(rt Router) {
+		rt.Get("/", EmptyHandlerFunc)
+		rt.Group("/users", func(rt Router) {
+			rt.Get("/:id", EmptyHandlerFunc)
+			rt.AddFuncTaskHandler("/:id/audit", func(Task) {})
+		}, traceFilter("audit"))
+	}, traceFilter("auth"))
+	s.Get("/administrators", EmptyHandlerFunc)
+
+	trace := func(path, deny string) (int, []string) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Deny", deny)
+		s.ServeHTTP(w, r)
+		return w.Code, w.Header()["X-Trace"]
+	}
+	code, filters := trace("/admin", "")
+	tt.AssertEq(code, http.StatusOK)
+	tt.AssertEq(filters, []string{"auth"})
+	code, filters = trace("/admin/users/1", "")
+	tt.AssertEq(code, http.StatusOK)
+	tt.AssertEq(filters, []string{"auth", "audit"})
+	code, filters = trace("/admin/users/1", "auth")
+	tt.AssertEq(code, http.StatusForbidden)
+	tt.AssertEq(filters, []string{"auth"})
+	// sibling route share the string prefix is not in group
+	code, filters = trace("/administrators", "auth")
+	tt.AssertEq(code, http.StatusOK)
+	tt.AssertEq(len(filters), 0)
+
+	tt.AssertNil(s.StartTask(false, "/admin/users/1/audit", nil))
+	tt.AssertNil(s.RemoveFilters("/admin"))
+	tt.AssertNil(s.AddFilter("/admin", FilterFunc(func(Request, Response, FilterChain) {})))
+	tt.AssertEq(s.StartTask(false, "/admin/users/1/audit", nil), ErrTaskRejected)
+}
@@ -0,0 +1,124 @@
+package zerver
+
+import (
+	"reflect"
+	"runtime"
+	"sort"
+)
+
+// RouteInfo describe a route, it's the node of route tree which has handler,
+// filters, websocket handler, task handler or timeout
+type RouteInfo struct {
+	Host      string   `json:"host,omitempty"`
+	Pattern   string   `json:"pattern"`
+	Name      string   `json:"name,omitempty"`
+	Vars      []string `json:"vars,omitempty"`    // named variables by order
+	Methods   []string `json:"methods,omitempty"` // methods has handler function
+	Filters   []string `json:"filters,omitempty"` // filters added to this pattern
+	WebSocket bool     `json:"websocket,omitempty"`
+	Task      bool     `json:"task,omitempty"`
+	Timeout   string   `json:"timeout,omitempty"`
+	// Meta is the metadata attached by SetMeta
+	Meta map[string]interface{} `json:"meta,omitempty"`
+
+	path string // compiled path
+}
+
+// Routes return informations of all routes, ordered by pattern
+func (rt *router) Routes() []RouteInfo {
+	names := make(map[string]string, len(rt.names))
+	for name, nr := range rt.names {
+		if n, has := names[nr.path]; !has || name < n {
+			names[nr.path] = name
+		}
+	}
+	var routes []RouteInfo
+	rt.collectRoutes("", names, &routes)
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Pattern < routes[j].Pattern
+	})
+	return routes
+}
+
+// collectRoutes collect route informations of current node and it's childs
+func (rt *router) collectRoutes(parentPath string, names map[string]string, routes *[]RouteInfo) {
+	path := parentPath + rt.str
+	if p := rt.processor; p != nil {
+		*routes = append(*routes, p.routeInfo(path, names[path]))
+	}
+	for _, c := range rt.childs {
+		c.collectRoutes(path, names, routes)
+	}
+}
+
+// routeInfo return route information of processor
+func (rp *routeProcessor) routeInfo(path, name string) RouteInfo {
+	info := RouteInfo{
+		Name: name,
+		path: path,
+	}
+	var vars map[string]int
+	if tp := rp.taskHandlerProcessor; tp != nil {
+		vars, info.Task = tp.vars, true
+	}
+	if wp := rp.wsHandlerProcessor; wp != nil {
+		vars, info.WebSocket = wp.vars, true
+	}
+	if hp := rp.handlerProcessor; hp != nil {
+		vars, info.Methods = hp.vars, handlerMethods(hp.handler, indicate)
+	}
+	for _, f := range rp.filters {
+		info.Filters = append(info.Filters, filterName(f))
+	}
+	if rp.timeout > 0 {
+		info.Timeout = rp.timeout.String()
+	}
+	info.Meta = rp.meta
+	info.Pattern, info.Vars = decompileVars(path, vars)
+	return info
+}
+
+// decompileVars convert compiled path to pattern, variables are filled with
+// their names, named variables are returned by order
+func decompileVars(path string, vars map[string]int) (string, []string) {
+	names := make(map[int]string, len(vars))
+	for name, index := range vars {
+		names[index] = name
+	}
+	var (
+		pattern   = make([]byte, 0, len(path))
+		varNames  []string
+		index     int
+		end       int
+		matchChar byte
+	)
+	for i := 0; i < len(path); i = end {
+		c := path[i]
+		if end = tokenEnd(path, i); !isMarker(c) {
+			pattern = append(pattern, c)
+			continue
+		}
+		if matchChar = _MATCH_WILDCARD; c == _REMAINSALL {
+			matchChar = _MATCH_REMAINSALL
+		}
+		pattern = append(pattern, matchChar)
+		if name := names[index]; name != "" {
+			pattern = append(pattern, name...)
+			varNames = append(varNames, name)
+		}
+		pattern = append(pattern, path[i+1:end]...) // constraint
+		index++
+	}
+	return string(pattern), varNames
+}
+
+// filterName return function name for FilterFunc, otherwise type name
+func filterName(f Filter) string {
+	if gf, is := f.(groupFilter); is {
+		f = gf.filter
+	}
+	if fn, is := f.(FilterFunc); is {
+		return runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	}
+	return reflect.TypeOf(f).String()
+}
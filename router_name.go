@@ -0,0 +1,230 @@
+package zerver
+
+import (
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+
+	. "github.com/cosiner/golib/errors"
+)
+
+type (
+	// namedRoute keep the compiled path and variable names of a named route
+	namedRoute struct {
+		path string   // compiled path
+		vars []string // variable names ordered by their index, "" for anonymous
+	}
+
+	// namedRouter give a name to routes registered by it
+	namedRouter struct {
+		name string
+		Router
+	}
+)
+
+const (
+	ErrRouteNameExist = Err("route name already exist")
+	ErrEmptyRouteName = Err("route name can't be empty")
+)
+
+// newNamedRoute compile pattern, and record the name of each variable
+func newNamedRoute(pattern string) (*namedRoute, error) {
+	path, vars, err := compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	nr := &namedRoute{path: path}
+	for i := 0; i < len(path); i = tokenEnd(path, i) {
+		if isMarker(path[i]) {
+			nr.vars = append(nr.vars, "")
+		}
+	}
+	for name, index := range vars {
+		nr.vars[index] = name
+	}
+	return nr, nil
+}
+
+// SetName give a name to pattern, it can be used to generate url by URLFor
+func (rt *router) SetName(pattern, name string) error {
+	if name == "" {
+		return ErrEmptyRouteName
+	}
+	if _, has := rt.names[name]; has {
+		return ErrRouteNameExist
+	}
+	if _, err := rt.findRoute(pattern); err != nil {
+		return err
+	}
+	nr, err := newNamedRoute(pattern)
+	if err == nil {
+		if rt.names == nil {
+			rt.names = make(map[string]*namedRoute)
+		}
+		rt.names[name] = nr
+	}
+	return err
+}
+
+// removeNames remove names of compiled path which has no route for them after
+// something removed from the path
+func (rt *router) removeNames(path string) {
+	for name, nr := range rt.names {
+		if nr.path != path {
+			continue
+		}
+		node := rt.findPath(path)
+		if node == nil || node.processor == nil || !node.processor.hasVars(nr.varIndexes()) {
+			delete(rt.names, name)
+		}
+	}
+}
+
+// varIndexes return the index of each named variable
+func (nr *namedRoute) varIndexes() map[string]int {
+	vars := make(map[string]int, len(nr.vars))
+	for index, name := range nr.vars {
+		if name != "" {
+			vars[name] = index
+		}
+	}
+	return vars
+}
+
+// URLFor generate url path of a named route, vars is pairs of variable name and
+// value, such as URLFor("user", "id", "123"). Values are escaped, for catch-all
+// variable, '/' is kept. If route not found, variable is missing or unknown,
+// an error is returned
+func (rt *router) URLFor(name string, vars ...string) (string, error) {
+	nr := rt.names[name]
+	if nr == nil {
+		return "", Errorf("route %s not found", name)
+	}
+	if len(vars)%2 != 0 {
+		return "", Errorf("route %s: variables must be name-value pairs", name)
+	}
+	values := make(map[string]string, len(vars)/2)
+	for i := 0; i < len(vars); i += 2 {
+		values[vars[i]] = vars[i+1]
+	}
+	var (
+		buf   = make([]byte, 0, len(nr.path)+len(vars)*8)
+		index int
+	)
+	for i, end := 0, 0; i < len(nr.path); i = end {
+		c := nr.path[i]
+		if end = tokenEnd(nr.path, i); !isMarker(c) {
+			buf = append(buf, c)
+			continue
+		}
+		varName := nr.vars[index]
+		index++
+		if varName == "" {
+			return "", Errorf("route %s: anonymous variable %d can't be filled", name, index)
+		}
+		value, has := values[varName]
+		if !has {
+			return "", Errorf("route %s: missing variable %s", name, varName)
+		}
+		if end-i > 1 {
+			if check, _ := parseConstraint(nr.path[i+2 : end-1]); !check(value) {
+				return "", Errorf("route %s: variable %s don't match constraint", name, varName)
+			}
+		}
+		delete(values, varName)
+		if c == _WILDCARD {
+			buf = append(buf, url.PathEscape(value)...)
+		} else {
+			buf = append(buf, escapeSubpath(value)...)
+		}
+	}
+	for varName := range values {
+		return "", Errorf("route %s: unknown variable %s", name, varName)
+	}
+	return string(buf), nil
+}
+
+// escapeSubpath escape each section of path, but keep the '/'
+func escapeSubpath(path string) string {
+	sections := strings.Split(path, "/")
+	for i := range sections {
+		sections[i] = url.PathEscape(sections[i])
+	}
+	return strings.Join(sections, "/")
+}
+
+// NewNamedRouter create a router which give name to routes registered by it,
+// so route can be named at registration, such as
+// NewNamedRouter(s, "user").Get("/user/:id", handler). If name can't be set,
+// the error is returned, but the route is still registered
+func NewNamedRouter(rt Router, name string) Router {
+	return &namedRouter{
+		name:   name,
+		Router: rt,
+	}
+}
+
+// setName give name to pattern if it's registered without error
+func (nr *namedRouter) setName(pattern string, err error) error {
+	if err == nil {
+		err = nr.Router.SetName(pattern, nr.name)
+	}
+	return err
+}
+
+// Get register a named function handler process GET request for given pattern
+func (nr *namedRouter) Get(pattern string, handlerFunc HandlerFunc) error {
+	return nr.setName(pattern, nr.Router.Get(pattern, handlerFunc))
+}
+
+// Post register a named function handler process POST request for given pattern
+func (nr *namedRouter) Post(pattern string, handlerFunc HandlerFunc) error {
+	return nr.setName(pattern, nr.Router.Post(pattern, handlerFunc))
+}
+
+// Put register a named function handler process PUT request for given pattern
+func (nr *namedRouter) Put(pattern string, handlerFunc HandlerFunc) error {
+	return nr.setName(pattern, nr.Router.Put(pattern, handlerFunc))
+}
+
+// Delete register a named function handler process DELETE request for given pattern
+func (nr *namedRouter) Delete(pattern string, handlerFunc HandlerFunc) error {
+	return nr.setName(pattern, nr.Router.Delete(pattern, handlerFunc))
+}
+
+// Patch register a named function handler process PATCH request for given pattern
+func (nr *namedRouter) Patch(pattern string, handlerFunc HandlerFunc) error {
+	return nr.setName(pattern, nr.Router.Patch(pattern, handlerFunc))
+}
+
+// Handle register a named function handler process given method for given pattern
+func (nr *namedRouter) Handle(method, pattern string, handlerFunc HandlerFunc) error {
+	return nr.setName(pattern, nr.Router.Handle(method, pattern, handlerFunc))
+}
+
+// AddFuncHandler add named function handler for given pattern and method
+func (nr *namedRouter) AddFuncHandler(pattern, method string, handler HandlerFunc) error {
+	return nr.setName(pattern, nr.Router.AddFuncHandler(pattern, method, handler))
+}
+
+// AddHandler add named handler for given pattern
+func (nr *namedRouter) AddHandler(pattern string, handler Handler) error {
+	return nr.setName(pattern, nr.Router.AddHandler(pattern, handler))
+}
+
+// AddOptionHandler add named option handler for given pattern
+func (nr *namedRouter) AddOptionHandler(pattern string, o *OptionHandler) error {
+	return nr.setName(pattern, nr.Router.AddOptionHandler(pattern, o))
+}
+
+// Mount mount a standard http.Handler to pattern, pattern without trailing '/'
+// is named
+func (nr *namedRouter) Mount(pattern string, handler http.Handler) error {
+	return nr.setName(mountPattern(pattern), nr.Router.Mount(pattern, handler))
+}
+
+// Static serve files of root for prefix, prefix without trailing '/' is named
+func (nr *namedRouter) Static(prefix string, root fs.FS, option StaticOption) error {
+	return nr.setName(mountPattern(prefix), nr.Router.Static(prefix, root, option))
+}
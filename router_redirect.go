@@ -0,0 +1,204 @@
+package zerver
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// RedirectOption decide which canonical path will be tried when a path is not
+// matched, if the canonical path is matched, client is redirected to it
+type RedirectOption uint8
+
+const (
+	// RedirectCleanPath clean the path, such as remove duplicate slashes, "."
+	// and "..", like path.Clean, but the trailing slash is kept
+	RedirectCleanPath RedirectOption = 1 << iota
+	// RedirectTrailingSlash add the trailing slash if path don't have one,
+	// otherwise remove it
+	RedirectTrailingSlash
+	// RedirectFoldCase match path case-insensitively
+	RedirectFoldCase
+
+	RedirectNone RedirectOption = 0
+	RedirectAll                 = RedirectCleanPath | RedirectTrailingSlash | RedirectFoldCase
+)
+
+// redirectHandler redirect all request to the location, GET and HEAD use 301,
+// others use 308 to keep method and body
+type redirectHandler struct {
+	EmptyHandler
+	location string
+}
+
+// SetRedirect set which canonical path will be tried when path is not matched,
+// default is RedirectNone
+func (rt *router) SetRedirect(option RedirectOption) {
+	rt.redirect = option
+}
+
+// canonicalHandler return a handler redirect to canonical url if there is one
+func (rt *router) canonicalHandler(u *url.URL) Handler {
+	p := rt.canonicalPath(u.Path)
+	if p == "" {
+		return nil
+	}
+	loc := &url.URL{
+		Path:     p,
+		RawQuery: u.RawQuery,
+	}
+	return redirectHandler{location: loc.String()}
+}
+
+// canonicalPath find the canonical path of given path by redirect option,
+// if not found, return ""
+func (rt *router) canonicalPath(p string) string {
+	if p == "" || p[0] != '/' {
+		return ""
+	}
+	option := rt.redirect
+	candidate := p
+	if option&RedirectCleanPath != 0 {
+		candidate = cleanPath(p)
+	}
+	if strings.HasPrefix(candidate, "//") {
+		return "" // will be treated as another host
+	}
+	candidates := []string{candidate}
+	if option&RedirectTrailingSlash != 0 {
+		candidates = append(candidates, toggleTrailingSlash(candidate))
+	}
+	for _, c := range candidates {
+		if c != p && rt.hasHandler(c) {
+			return c
+		}
+	}
+	if option&RedirectFoldCase != 0 {
+		for _, c := range candidates {
+			if buf, matched := rt.matchFold(c, 0, make([]byte, 0, len(c))); matched {
+				if c = string(buf); c != p {
+					return c
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// hasHandler check whether there is a handler for path
+func (rt *router) hasHandler(path string) bool {
+	rt, _ = rt.matchOne(path, _ROUTE_HANDLER, nil)
+	return rt != nil
+}
+
+// matchFold match path case-insensitively with current node and it's childs,
+// the route path is appended to buf, variable values keep as is. Only the node
+// has handler is considered matched
+func (rt *router) matchFold(path string, pathIndex int, buf []byte) ([]byte, bool) {
+	var (
+		str             = rt.str
+		strLen, pathLen = len(str), len(path)
+		constraintIndex int
+		matched         bool
+	)
+	for strIndex := 0; strIndex < strLen; {
+		if pathIndex == pathLen && (str[strIndex] != _REMAINSALL || !rt.emptyRemains()) {
+			return buf, false
+		}
+		c := str[strIndex]
+		strIndex++
+		if !isMarker(c) {
+			if !equalFold(c, path[pathIndex]) {
+				return buf, false
+			}
+			buf = append(buf, c)
+			pathIndex++
+			continue
+		}
+		var check constraint
+		if strIndex < strLen && str[strIndex] == _CONSTRAINT_START {
+			strIndex = tokenEnd(str, strIndex-1)
+			check = rt.constraints[constraintIndex]
+			constraintIndex++
+		}
+		start := pathIndex
+		if c == _WILDCARD {
+			if pathIndex, matched = varEnd(str, strIndex, path, pathIndex, true); !matched {
+				return buf, false
+			}
+		} else {
+			pathIndex = pathLen
+		}
+		value := path[start:pathIndex]
+		if check != nil && !check(value) {
+			return buf, false
+		}
+		buf = append(buf, value...)
+	}
+	if pathIndex == pathLen {
+		if rt.processor != nil && rt.processor.handlerProcessor != nil {
+			return buf, true
+		}
+		if child := rt.remainsChild(); child != nil {
+			return child.matchFold(path, pathIndex, buf)
+		}
+		return buf, false
+	}
+	for i, c := range rt.chars {
+		if isMarker(c) || equalFold(c, path[pathIndex]) {
+			if b, matched := rt.childs[i].matchFold(path, pathIndex, buf); matched {
+				return b, true
+			}
+		}
+	}
+	return buf, false
+}
+
+// Handler implements MethodIndicator, all methods are redirected
+func (rh redirectHandler) Handler(string) HandlerFunc {
+	return rh.redirect
+}
+
+func (rh redirectHandler) redirect(req Request, resp Response) {
+	resp.SetHeader(HEADER_LOCATION, rh.location)
+	if m := req.Method(); m == GET || m == HEAD {
+		resp.ReportMovedPermanently()
+	} else {
+		resp.ReportPermanentRedirect()
+	}
+}
+
+// cleanPath is same as path.Clean, but keep the trailing slash
+func cleanPath(p string) string {
+	cp := path.Clean(p)
+	if cp != "/" && strings.HasSuffix(p, "/") {
+		cp += "/"
+	}
+	return cp
+}
+
+// toggleTrailingSlash remove the trailing slash of path if exist, otherwise add
+// one, root path is not changed
+func toggleTrailingSlash(p string) string {
+	switch l := len(p); {
+	case l == 1:
+		return p
+	case p[l-1] == '/':
+		return p[:l-1]
+	}
+	return p + "/"
+}
+
+// equalFold compare two ASCII characters case-insensitively
+func equalFold(a, b byte) bool {
+	if a == b {
+		return true
+	}
+	if 'A' <= a && a <= 'Z' {
+		a += 'a' - 'A'
+	}
+	if 'A' <= b && b <= 'Z' {
+		b += 'a' - 'A'
+	}
+	return a == b
+}
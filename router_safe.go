@@ -0,0 +1,498 @@
+package zerver
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/cosiner/golib/errors"
+)
+
+type (
+	// safeRouter is a concurrency-safe Router, routes can be added or removed
+	// while serving. Match always use a snapshot of route tree without lock,
+	// writes are serialized, after router is inited, each write operate on a
+	// copy of route tree, then replace the snapshot
+	safeRouter struct {
+		mu   sync.Mutex
+		tree atomic.Value // *snapshot
+		// live is set after Init, routes added after it will be inited
+		// immediately, routes removed will be destroyed
+		live  bool
+		inits initializers
+		// initialize is set by server, it's used to init routes added while
+		// serving instead of inits
+		initialize func(ServerInitializer) error
+		// retired snapshots still used by requests, what removed is
+		// destroyed after all of them are released
+		retired []*snapshot
+		removed []*routeProcessor
+	}
+
+	// snapshot is a version of route tree, each matched request hold a
+	// reference to it until the request finished
+	snapshot struct {
+		*router
+		sr      *safeRouter
+		refs    int64
+		retired int32
+	}
+
+	// initializers keep the init functions passed to Init
+	initializers struct {
+		handler   func(Handler) bool
+		filter    func(Filter) bool
+		wsHandler func(WebSocketHandler) bool
+		task      func(TaskHandler) bool
+	}
+)
+
+const (
+	ErrInitFailed = Err("failed to init handler or filter")
+)
+
+// newSafeRouter wrap a route tree to a safeRouter
+func newSafeRouter(rt *router) *safeRouter {
+	sr := new(safeRouter)
+	sr.tree.Store(&snapshot{router: rt, sr: sr})
+	return sr
+}
+
+// load return current snapshot of route tree
+func (sr *safeRouter) load() *snapshot {
+	return sr.tree.Load().(*snapshot)
+}
+
+// acquire return current snapshot and hold a reference to it, it will not be
+// retired silently between load and reference
+func (sr *safeRouter) acquire() *snapshot {
+	for {
+		s := sr.load()
+		atomic.AddInt64(&s.refs, 1)
+		if sr.load() == s {
+			return s
+		}
+		s.release()
+	}
+}
+
+// release release a reference of snapshot, it's called when url variables of
+// the request is destroyed
+func (s *snapshot) release() {
+	if atomic.AddInt64(&s.refs, -1) == 0 && atomic.LoadInt32(&s.retired) != 0 {
+		s.sr.mu.Lock()
+		removed := s.sr.reap()
+		s.sr.mu.Unlock()
+		destroyProcessors(removed)
+	}
+}
+
+// replace replace current snapshot with a new route tree, the old one is
+// retired, what can be destroyed is returned. It must be called with lock
+func (sr *safeRouter) replace(rt *router) []*routeProcessor {
+	old := sr.load()
+	sr.tree.Store(&snapshot{router: rt, sr: sr})
+	atomic.StoreInt32(&old.retired, 1)
+	sr.retired = append(sr.retired, old)
+	return sr.reap()
+}
+
+// reap forget retired snapshots which are released, if all of them are
+// released, what removed is returned to be destroyed without lock, for Destroy
+// of them may also change routes. It must be called with lock
+func (sr *safeRouter) reap() (removed []*routeProcessor) {
+	retired := sr.retired[:0]
+	for _, s := range sr.retired {
+		if atomic.LoadInt64(&s.refs) != 0 {
+			retired = append(retired, s)
+		}
+	}
+	for i := len(retired); i < len(sr.retired); i++ {
+		sr.retired[i] = nil
+	}
+	sr.retired = retired
+	if len(retired) == 0 {
+		removed, sr.removed = sr.removed, nil
+	}
+	return removed
+}
+
+// destroyProcessors destroy processors removed from route tree
+func destroyProcessors(rps []*routeProcessor) {
+	for _, rp := range rps {
+		rp.destroy()
+	}
+}
+
+// hold make the indexer hold the reference of snapshot
+func (s *snapshot) hold(indexer URLVarIndexer) {
+	indexer.varIndexer().owner = s
+}
+
+// update modify route tree by given function, if router is live, the
+// modification is done on a copy of tree, and what added is returned by fn
+// to be inited. Init is called without lock for it may also change routes, if
+// the tree is changed meanwhile, fn is applied again to the latest one. If
+// function or init failed, the snapshot is not changed, and what already
+// inited is destroyed
+func (sr *safeRouter) update(fn func(*router) (*routeProcessor, error)) error {
+	sr.mu.Lock()
+	base := sr.load()
+	if !sr.live {
+		_, err := fn(base.router)
+		sr.mu.Unlock()
+		return err
+	}
+	rt := base.router.clone()
+	added, err := fn(rt)
+	if err != nil || added == nil {
+		var removed []*routeProcessor
+		if err == nil {
+			removed = sr.replace(rt)
+		}
+		sr.mu.Unlock()
+		destroyProcessors(removed)
+		return err
+	}
+	sr.mu.Unlock()
+
+	if err = sr.init(added); err != nil {
+		return err
+	}
+	sr.mu.Lock()
+	if cur := sr.load(); cur != base {
+		rt = cur.router.clone()
+		if _, err = fn(rt); err != nil {
+			sr.mu.Unlock()
+			added.destroy()
+			return err
+		}
+	}
+	removed := sr.replace(rt)
+	if !sr.live { // destroyed meanwhile, it will be inited by next Init
+		removed = append(removed, added)
+	}
+	sr.mu.Unlock()
+	destroyProcessors(removed)
+	return nil
+}
+
+// init init what added, if failed, destroy inited ones in reverse order. The
+// error of initializer set by server is returned, otherwise ErrInitFailed
+func (sr *safeRouter) init(added *routeProcessor) error {
+	sr.mu.Lock()
+	inits, initialize := sr.inits, sr.initialize
+	sr.mu.Unlock()
+	var (
+		inited []interface {
+			Destroy()
+		}
+		err error
+	)
+	initOne := func(i interface {
+		ServerInitializer
+		Destroy()
+	}, fallback func() bool) bool {
+		if initialize != nil {
+			err = initialize(i)
+		} else if !fallback() {
+			err = ErrInitFailed
+		}
+		if err == nil {
+			inited = append(inited, i)
+		}
+		return err == nil
+	}
+	added.init(func(h Handler) bool {
+		return initOne(h, func() bool { return inits.handler(h) })
+	}, func(f Filter) bool {
+		return initOne(f, func() bool { return inits.filter(f) })
+	}, func(h WebSocketHandler) bool {
+		return initOne(h, func() bool { return inits.wsHandler(h) })
+	}, func(h TaskHandler) bool {
+		return initOne(h, func() bool { return inits.task(h) })
+	})
+	if err != nil {
+		for i := len(inited) - 1; i >= 0; i-- {
+			inited[i].Destroy()
+		}
+	}
+	return err
+}
+
+// remove remove something from route tree, if router is live, what removed is
+// destroyed after all requests use old snapshots are finished
+func (sr *safeRouter) remove(pattern string, fn func(rp, removed *routeProcessor)) error {
+	sr.mu.Lock()
+	rt := sr.load().router
+	if !sr.live {
+		_, err := rt.removePattern(pattern, fn)
+		sr.mu.Unlock()
+		return err
+	}
+	rt = rt.clone()
+	removed, err := rt.removePattern(pattern, fn)
+	if err != nil {
+		sr.mu.Unlock()
+		return err
+	}
+	sr.removed = append(sr.removed, removed)
+	destroyed := sr.replace(rt)
+	sr.mu.Unlock()
+	destroyProcessors(destroyed)
+	return nil
+}
+
+// Init init all handlers, filters, websocket handlers in route tree, after
+// that, routes added will be inited immediately. Init is called without lock,
+// routes added by it are inited by the live initializer
+func (sr *safeRouter) Init(initHandler func(Handler) bool,
+	initFilter func(Filter) bool,
+	initWebSocketHandler func(WebSocketHandler) bool,
+	initTaskHandler func(TaskHandler) bool) {
+	sr.mu.Lock()
+	sr.inits = initializers{
+		handler:   initHandler,
+		filter:    initFilter,
+		wsHandler: initWebSocketHandler,
+		task:      initTaskHandler,
+	}
+	sr.live = true
+	rt := sr.load().router
+	sr.mu.Unlock()
+	rt.Init(initHandler, initFilter, initWebSocketHandler, initTaskHandler)
+}
+
+// SetLiveInitializer set the initializer of routes added while serving, it's
+// called by server before Init
+func (sr *safeRouter) SetLiveInitializer(initialize func(ServerInitializer) error) {
+	sr.mu.Lock()
+	sr.initialize = initialize
+	sr.mu.Unlock()
+}
+
+// Destroy destroy router and all handlers, filters, websocket handlers, what
+// removed but still wait for requests is also destroyed, so it should be
+// called after all requests are finished
+func (sr *safeRouter) Destroy() {
+	sr.mu.Lock()
+	sr.live = false
+	sr.inits, sr.initialize = initializers{}, nil
+	removed, rt := sr.removed, sr.load().router
+	sr.removed, sr.retired = nil, nil
+	sr.mu.Unlock()
+	destroyProcessors(removed)
+	rt.Destroy()
+}
+
+// Get register a function handler process GET request for given pattern
+func (sr *safeRouter) Get(pattern string, handlerFunc HandlerFunc) error {
+	return sr.AddFuncHandler(pattern, GET, handlerFunc)
+}
+
+// Post register a function handler process POST request for given pattern
+func (sr *safeRouter) Post(pattern string, handlerFunc HandlerFunc) error {
+	return sr.AddFuncHandler(pattern, POST, handlerFunc)
+}
+
+// Put register a function handler process PUT request for given pattern
+func (sr *safeRouter) Put(pattern string, handlerFunc HandlerFunc) error {
+	return sr.AddFuncHandler(pattern, PUT, handlerFunc)
+}
+
+// Delete register a function handler process DELETE request for given pattern
+func (sr *safeRouter) Delete(pattern string, handlerFunc HandlerFunc) error {
+	return sr.AddFuncHandler(pattern, DELETE, handlerFunc)
+}
+
+// Patch register a function handler process PATCH request for given pattern
+func (sr *safeRouter) Patch(pattern string, handlerFunc HandlerFunc) error {
+	return sr.AddFuncHandler(pattern, PATCH, handlerFunc)
+}
+
+// Handle register a function handler process given method for given pattern
+func (sr *safeRouter) Handle(method, pattern string, handlerFunc HandlerFunc) error {
+	return sr.AddFuncHandler(pattern, method, handlerFunc)
+}
+
+// Group create a group router with prefix and filters
+func (sr *safeRouter) Group(prefix string, fn func(Router), filters ...Filter) {
+	fn(NewGroupRouter(sr, prefix, filters...))
+}
+
+// AddFuncHandler add function handler to router for given pattern and method
+func (sr *safeRouter) AddFuncHandler(pattern, method string, handler HandlerFunc) error {
+	return sr.update(func(rt *router) (*routeProcessor, error) {
+		return nil, rt.AddFuncHandler(pattern, method, handler)
+	})
+}
+
+// AddHandler add handler to router for given pattern
+func (sr *safeRouter) AddHandler(pattern string, handler Handler) error {
+	return sr.update(func(rt *router) (*routeProcessor, error) {
+		return &routeProcessor{
+			handlerProcessor: &handlerProcessor{handler: handler},
+		}, rt.AddHandler(pattern, handler)
+	})
+}
+
+func (sr *safeRouter) AddOptionHandler(pattern string, o *OptionHandler) error {
+	return sr.AddHandler(pattern, newFuncHandlerFrom(o))
+}
+
+// Mount mount a standard http.Handler to pattern and all sub paths of it
+func (sr *safeRouter) Mount(pattern string, handler http.Handler) error {
+	return sr.update(func(rt *router) (*routeProcessor, error) {
+		return nil, rt.Mount(pattern, handler)
+	})
+}
+
+// Static serve files of root for prefix and all sub paths of it
+func (sr *safeRouter) Static(prefix string, root fs.FS, option StaticOption) error {
+	return sr.update(func(rt *router) (*routeProcessor, error) {
+		return nil, rt.Static(prefix, root, option)
+	})
+}
+
+// AddFuncFilter add function filter to router for given pattern
+func (sr *safeRouter) AddFuncFilter(pattern string, filter FilterFunc) error {
+	return sr.AddFilter(pattern, filter)
+}
+
+// AddFilter add filter to router for given pattern
+func (sr *safeRouter) AddFilter(pattern string, filter Filter) error {
+	return sr.update(func(rt *router) (*routeProcessor, error) {
+		return &routeProcessor{
+			filters: []Filter{filter},
+		}, rt.AddFilter(pattern, filter)
+	})
+}
+
+// AddFuncWebSocketHandler add funciton websocket handler to router for given pattern
+func (sr *safeRouter) AddFuncWebSocketHandler(pattern string, handler WebSocketHandlerFunc) error {
+	return sr.AddWebSocketHandler(pattern, handler)
+}
+
+// AddWebSocetHandler add websocket handler to router for given pattern
+func (sr *safeRouter) AddWebSocketHandler(pattern string, handler WebSocketHandler) error {
+	return sr.update(func(rt *router) (*routeProcessor, error) {
+		return &routeProcessor{
+			wsHandlerProcessor: &wsHandlerProcessor{wsHandler: handler},
+		}, rt.AddWebSocketHandler(pattern, handler)
+	})
+}
+
+// AddFuncTaskHandler add function task handler to router for given pattern
+func (sr *safeRouter) AddFuncTaskHandler(pattern string, handler TaskHandlerFunc) error {
+	return sr.AddTaskHandler(pattern, handler)
+}
+
+// AddTaskHandler add task handler to router for given pattern
+func (sr *safeRouter) AddTaskHandler(pattern string, handler TaskHandler) error {
+	return sr.update(func(rt *router) (*routeProcessor, error) {
+		return &routeProcessor{
+			taskHandlerProcessor: &taskHandlerProcessor{taskHandler: handler},
+		}, rt.AddTaskHandler(pattern, handler)
+	})
+}
+
+// SetTimeout set timeout for pattern and all routes start with it
+func (sr *safeRouter) SetTimeout(pattern string, timeout time.Duration) error {
+	return sr.update(func(rt *router) (*routeProcessor, error) {
+		return nil, rt.SetTimeout(pattern, timeout)
+	})
+}
+
+// SetName give a name to pattern, it can be used to generate url by URLFor
+func (sr *safeRouter) SetName(pattern, name string) error {
+	return sr.update(func(rt *router) (*routeProcessor, error) {
+		return nil, rt.SetName(pattern, name)
+	})
+}
+
+// SetMeta attach metadata to pattern
+func (sr *safeRouter) SetMeta(pattern, key string, value interface{}) error {
+	return sr.update(func(rt *router) (*routeProcessor, error) {
+		return nil, rt.SetMeta(pattern, key, value)
+	})
+}
+
+// SetRedirect set which canonical path will be tried when path is not matched
+func (sr *safeRouter) SetRedirect(option RedirectOption) {
+	sr.update(func(rt *router) (*routeProcessor, error) {
+		rt.SetRedirect(option)
+		return nil, nil
+	})
+}
+
+// RemoveHandler remove handler of pattern, include function handlers of all
+// methods
+func (sr *safeRouter) RemoveHandler(pattern string) error {
+	return sr.remove(pattern, func(rp, removed *routeProcessor) {
+		removed.handlerProcessor, rp.handlerProcessor = rp.handlerProcessor, nil
+	})
+}
+
+// RemoveFilters remove all filters of pattern
+func (sr *safeRouter) RemoveFilters(pattern string) error {
+	return sr.remove(pattern, func(rp, removed *routeProcessor) {
+		removed.filters, rp.filters = rp.filters, nil
+	})
+}
+
+// RemoveWebSocketHandler remove websocket handler of pattern
+func (sr *safeRouter) RemoveWebSocketHandler(pattern string) error {
+	return sr.remove(pattern, func(rp, removed *routeProcessor) {
+		removed.wsHandlerProcessor, rp.wsHandlerProcessor = rp.wsHandlerProcessor, nil
+	})
+}
+
+// RemoveTaskHandler remove task handler of pattern
+func (sr *safeRouter) RemoveTaskHandler(pattern string) error {
+	return sr.remove(pattern, func(rp, removed *routeProcessor) {
+		removed.taskHandlerProcessor, rp.taskHandlerProcessor = rp.taskHandlerProcessor, nil
+	})
+}
+
+// URLFor generate url path of a named route
+func (sr *safeRouter) URLFor(name string, vars ...string) (string, error) {
+	return sr.load().URLFor(name, vars...)
+}
+
+// PrintRouteTree print an route tree
+func (sr *safeRouter) PrintRouteTree(w io.Writer) {
+	sr.load().PrintRouteTree(w)
+}
+
+// Routes return informations of all routes
+func (sr *safeRouter) Routes() []RouteInfo {
+	return sr.load().Routes()
+}
+
+// MatchHandlerFilters match url to fin final handler and each filters
+func (sr *safeRouter) MatchHandlerFilters(url *url.URL) (Handler, URLVarIndexer, []Filter) {
+	s := sr.acquire()
+	handler, indexer, filters := s.MatchHandlerFilters(url)
+	s.hold(indexer)
+	return handler, indexer, filters
+}
+
+// MatchWebSocketHandler match url to find final websocket handler and filters
+func (sr *safeRouter) MatchWebSocketHandler(url *url.URL) (WebSocketHandler, URLVarIndexer, []Filter) {
+	s := sr.acquire()
+	handler, indexer, filters := s.MatchWebSocketHandler(url)
+	s.hold(indexer)
+	return handler, indexer, filters
+}
+
+// MatchTaskHandler match url to find final task handler and filters
+func (sr *safeRouter) MatchTaskHandler(url *url.URL) (TaskHandler, URLVarIndexer, []Filter) {
+	s := sr.acquire()
+	handler, indexer, filters := s.MatchTaskHandler(url)
+	s.hold(indexer)
+	return handler, indexer, filters
+}
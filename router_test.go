@@ -1,10 +1,14 @@
 package zerver
 
 import (
+	"bytes"
+	"net/http"
 	"net/url"
 	"os"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/cosiner/golib/test"
 
@@ -22,7 +26,7 @@ func TestCompile(t *testing.T) {
 
 // routes is copy from github.com/julienschmidt/go-http-routing-benchmark
 func rt() *router {
-	processor := new(routeProcessor)
+	processor := &routeProcessor{handlerProcessor: &handlerProcessor{}}
 	node := &router{str: "/user/id", processor: processor}
 	fn := func(n *router, success bool) {
 		if success {
@@ -305,7 +309,7 @@ func BenchmarkMatchRouteOne(b *testing.B) {
 		// for continu {
 		// 	pathIndex, vars, n, continu = n.matchMulti(path, pathIndex, vars)
 		// }
-		_, _ = r.matchOne(path, make([]string, 0, 2))
+		_, _ = r.matchOne(path, _ROUTE_HANDLER, make([]string, 0, 2))
 	}
 }
 
@@ -316,14 +320,8 @@ func BenchmarkMatchRouteMultiple(b *testing.B) {
 	path := "/repos/julienschmidt/httprouter/stargazers"
 	// path := "/user/aa/exist"
 	for i := 0; i < b.N; i++ {
-		pathIndex := 0
 		var vars []string = make([]string, 0, 2)
-		var continu = true
-		n := r
-		for continu {
-			pathIndex, vars, n, continu = n.matchMultiple(path, pathIndex, vars)
-		}
-		if n == nil {
+		if n, _ := r.matchMultiple(path, routeMatch{values: vars}); n == nil {
 			b.Fail()
 		}
 	}
@@ -337,9 +335,9 @@ func TestRoute(t *testing.T) {
 	// OnErrPanic(rt.AddHandler("/vba/:id", newFuncHandler()))
 	// OnErrPanic(rt.AddHandler("/v0a/:id", newFuncHandler()))
 	rt.PrintRouteTree(os.Stdout)
-	_, value := rt.matchOne("/user.json", nil)
+	_, value := rt.matchOne("/user.json", _ROUTE_HANDLER, nil)
 	t.Log(value)
-	_, value = rt.matchOne("/vbc", nil)
+	_, value = rt.matchOne("/vbc", _ROUTE_HANDLER, nil)
 	t.Log(value)
 }
 
@@ -348,8 +346,10 @@ func TestFilterHideHandler(t *testing.T) {
 	rt := NewRouter()
 	rt.AddFuncFilter("/user/12:id", EmptyFilterFunc)
 	rt.AddFuncHandler("/user/:id", "GET", EmptyHandlerFunc)
-	h, _, _ := rt.MatchHandlerFilters(&url.URL{Path: "/user/1234"})
-	tt.AssertTrue(h == nil)
+	// node of filter has no handler, the variable sibling is matched
+	h, _, fs := rt.MatchHandlerFilters(&url.URL{Path: "/user/1234"})
+	tt.AssertTrue(h != nil)
+	tt.AssertEq(len(fs), 0)
 	h, _, _ = rt.MatchHandlerFilters(&url.URL{Path: "/user/2234"})
 	tt.AssertTrue(h != nil)
 }
@@ -361,3 +361,298 @@ func TestConflictWildcardCatchall(t *testing.T) {
 	e := rt.AddFuncHandler("/*user", "GET", EmptyHandlerFunc)
 	tt.AssertTrue(e != nil)
 }
+
+func TestURLFor(t *testing.T) {
+	tt := test.WrapTest(t)
+	rt := NewRouter()
+	for _, pattern := range []string{"/user/info/:id", "/home/*subpath", "/user.:format", "/admin/user/:id"} {
+		tt.AssertNil(rt.Get(pattern, EmptyHandlerFunc))
+	}
+	tt.AssertNil(rt.SetName("/user/info/:id", "user"))
+	tt.AssertTrue(rt.SetName("/user/:id", "user") == ErrRouteNameExist)
+	tt.AssertTrue(rt.SetName("/user/:id", "user_id") == ErrRouteNotFound)
+	tt.AssertTrue(rt.SetName("/user/info/:uid", "user_id") == ErrRouteNotFound)
+	tt.AssertNil(rt.SetName("/home/*subpath", "home"))
+	tt.AssertNil(rt.SetName("/user.:format", "format"))
+	rt.Group("/admin", func(rt Router) {
+		tt.AssertNil(rt.SetName("/user/:id", "admin_user"))
+	})
+
+	u, err := rt.URLFor("user", "id", "a b")
+	tt.AssertNil(err)
+	tt.AssertEq(u, "/user/info/a%20b")
+	u, err = rt.URLFor("home", "subpath", "js/a?.js")
+	tt.AssertNil(err)
+	tt.AssertEq(u, "/home/js/a%3F.js")
+	u, err = rt.URLFor("format", "format", "json")
+	tt.AssertNil(err)
+	tt.AssertEq(u, "/user.json")
+	u, err = rt.URLFor("admin_user", "id", "1")
+	tt.AssertNil(err)
+	tt.AssertEq(u, "/admin/user/1")
+
+	_, err = rt.URLFor("user")
+	tt.AssertTrue(err != nil)
+	_, err = rt.URLFor("user", "id", "1", "name", "2")
+	tt.AssertTrue(err != nil)
+	_, err = rt.URLFor("none")
+	tt.AssertTrue(err != nil)
+
+	// name at registration
+	tt.AssertNil(NewNamedRouter(rt, "post").Get("/post/:id", EmptyHandlerFunc))
+	rt.Group("/admin", func(rt Router) {
+		tt.AssertNil(NewNamedRouter(rt, "admin_post").Post("/post/:id", EmptyHandlerFunc))
+	})
+	tt.AssertTrue(NewNamedRouter(rt, "post").Get("/posts", EmptyHandlerFunc) == ErrRouteNameExist)
+	tt.AssertNil(NewNamedRouter(rt, "files").Mount("/files/", http.NotFoundHandler()))
+	u, err = rt.URLFor("post", "id", "1")
+	tt.AssertNil(err)
+	tt.AssertEq(u, "/post/1")
+	u, err = rt.URLFor("admin_post", "id", "1")
+	tt.AssertNil(err)
+	tt.AssertEq(u, "/admin/post/1")
+	u, err = rt.URLFor("files")
+	tt.AssertNil(err)
+	tt.AssertEq(u, "/files")
+
+	// name is removed with the route
+	tt.AssertNil(rt.RemoveHandler("/post/:id"))
+	_, err = rt.URLFor("post", "id", "1")
+	tt.AssertTrue(err != nil)
+	tt.AssertNil(rt.Get("/post/:id", EmptyHandlerFunc))
+	tt.AssertNil(rt.SetName("/post/:id", "post"))
+}
+
+func TestURLVarConstraint(t *testing.T) {
+	tt := test.WrapTest(t)
+	rt := NewRouter()
+	handler := func(name string) HandlerFunc {
+		return func(_ Request, resp Response) {
+			resp.SetValue(name)
+		}
+	}
+	tt.AssertNil(rt.Get("/user/:id<int>", handler("id")))
+	tt.AssertNil(rt.Get("/user/:uuid<uuid>", handler("uuid")))
+	tt.AssertNil(rt.Get("/user/:slug<[a-z-]+>", handler("slug")))
+	tt.AssertNil(rt.Get("/user/:name", handler("name")))
+	tt.AssertNil(rt.Get("/file/*image<.+\\.(png|jpg)>", handler("image")))
+	tt.AssertTrue(rt.Get("/user/:id<[a-z>", handler("invalid")) != nil)
+	tt.AssertTrue(rt.Get("/user/:id<>", handler("invalid")) != nil)
+
+	for path, expect := range map[string]string{
+		"/user/123":  "id",
+		"/user/-123": "id",
+		"/user/0f8fad5b-d9cb-469f-a165-70867728950e": "uuid",
+		"/user/john-doe": "slug",
+		"/user/John":     "name",
+		"/file/a/b.png":  "image",
+		"/file/a/b.gif":  "",
+	} {
+		h, indexer, _ := rt.MatchHandlerFilters(&url.URL{Path: path})
+		if expect == "" {
+			tt.AssertTrue(h == nil, path)
+			continue
+		}
+		tt.AssertTrue(h != nil, path)
+		resp := &response{}
+		indicateHandler(GET, h)(nil, resp)
+		tt.AssertEq(resp.Value(), expect, path)
+		tt.AssertTrue(indexer.URLVar(expect) == path[strings.IndexByte(path[1:], '/')+2:], path)
+	}
+}
+
+func TestHandleMethod(t *testing.T) {
+	tt := test.WrapTest(t)
+	rt := new(router)
+	tt.AssertNil(rt.Handle("PROPFIND", "/dav/*path", EmptyHandlerFunc))
+	tt.AssertNil(rt.Handle("mkcol", "/dav/*path", EmptyHandlerFunc))
+	tt.AssertNil(rt.Get("/dav/*path", EmptyHandlerFunc))
+	tt.AssertEq(rt.Handle("BAD METHOD", "/dav/*path", EmptyHandlerFunc), ErrInvalidMethod)
+	tt.AssertEq(rt.Handle("LOCK", "/dav/*file", EmptyHandlerFunc), ErrConflictPathVar)
+	tt.AssertEq(rt.AddHandler("/dav/*path", newFuncHandler()), ErrHandlerExist)
+
+	handler, _, _ := rt.MatchHandlerFilters(&url.URL{Path: "/dav/a/b"})
+	tt.AssertTrue(indicateHandler("MKCOL", handler) != nil)
+	tt.AssertTrue(indicateHandler("LOCK", handler) == nil)
+	tt.AssertEq(allowedMethods(handler), "GET, HEAD, OPTIONS, MKCOL, PROPFIND")
+
+	buf := bytes.NewBuffer(nil)
+	rt.PrintRouteTree(buf)
+	tt.AssertTrue(strings.Contains(buf.String(), "/dav/* [GET, MKCOL, PROPFIND]"))
+}
+
+func TestEmptyCatchAll(t *testing.T) {
+	tt := test.WrapTest(t)
+	rt := new(router)
+	tt.AssertNil(rt.Get("/home/*subpath", EmptyHandlerFunc))
+	tt.AssertNil(rt.Mount("/mount", http.NotFoundHandler()))
+	tt.AssertNil(rt.Static("/static", fstest.MapFS{}, StaticNone))
+	// sibling routes split the node before catch-all
+	tt.AssertNil(rt.Get("/mount/x", EmptyHandlerFunc))
+	tt.AssertNil(rt.Get("/static/x", EmptyHandlerFunc))
+
+	for path, matched := range map[string]bool{
+		"/home/a":   true,
+		"/home/":    false,
+		"/mount":    true,
+		"/mount/":   true,
+		"/mount/y":  true,
+		"/static":   true,
+		"/static/":  true,
+		"/static/y": true,
+	} {
+		h, _, _ := rt.MatchHandlerFilters(&url.URL{Path: path})
+		tt.AssertEq(h != nil, matched, path)
+	}
+	rt.SetRedirect(RedirectFoldCase)
+	tt.AssertEq(rt.canonicalPath("/MOUNT/"), "/mount/")
+
+	// each handler is inited only once
+	inited := make(map[Handler]bool)
+	rt.Init(func(h Handler) bool {
+		tt.AssertTrue(!inited[h])
+		inited[h] = true
+		return true
+	}, nil, nil, nil)
+}
+
+func TestCanonicalPath(t *testing.T) {
+	tt := test.WrapTest(t)
+	rt := new(router)
+	tt.AssertNil(rt.Get("/users", EmptyHandlerFunc))
+	tt.AssertNil(rt.Get("/users/:id<int>/Profile", EmptyHandlerFunc))
+	tt.AssertNil(rt.Get("/files/*path", EmptyHandlerFunc))
+
+	rt.SetRedirect(RedirectAll)
+	for path, canonical := range map[string]string{
+		"/users":                 "",
+		"/users/":                "/users",
+		"//users":                "/users",
+		"/a/../users/./":         "/users",
+		"/Users":                 "/users",
+		"/USERS/12/profile/":     "/users/12/Profile",
+		"/users/ab/profile":      "",
+		"/FILES/Docs/README.md/": "/files/Docs/README.md/",
+		"/none":                  "",
+	} {
+		tt.AssertEq(rt.canonicalPath(path), canonical, path)
+	}
+
+	rt.SetRedirect(RedirectTrailingSlash)
+	tt.AssertEq(rt.canonicalPath("/users/"), "/users")
+	tt.AssertEq(rt.canonicalPath("//users/"), "")
+	tt.AssertEq(rt.canonicalPath("/Users/"), "")
+}
+
+func TestRoutes(t *testing.T) {
+	tt := test.WrapTest(t)
+	rt := new(router)
+	tt.AssertNil(rt.Get("/user/:id<int>", EmptyHandlerFunc))
+	tt.AssertNil(rt.Post("/user/:id<int>", EmptyHandlerFunc))
+	tt.AssertNil(rt.AddFuncFilter("/user", EmptyFilterFunc))
+	tt.AssertNil(rt.SetTimeout("/user", time.Second))
+	tt.AssertNil(rt.AddFuncTaskHandler("/task/:/*file", func(Task) {}))
+	tt.AssertNil(rt.SetName("/user/:id<int>", "user"))
+
+	routes := rt.Routes()
+	tt.AssertEq(len(routes), 3)
+	tt.AssertEq(routes[0].Pattern, "/task/:/*file")
+	tt.AssertEq(routes[0].Vars, []string{"file"})
+	tt.AssertTrue(routes[0].Task)
+	tt.AssertEq(routes[1].Pattern, "/user")
+	tt.AssertEq(routes[1].Filters, []string{"github.com/cosiner/zerver.EmptyFilterFunc"})
+	tt.AssertEq(routes[1].Timeout, "1s")
+	tt.AssertEq(routes[2], RouteInfo{
+		Pattern: "/user/:id<int>",
+		Name:    "user",
+		Vars:    []string{"id"},
+		Methods: []string{"GET", "POST"},
+		path:    "/user/|<int>",
+	})
+}
+
+func TestMultipleVarsInSection(t *testing.T) {
+	tt := test.WrapTest(t)
+	rt := NewRouter()
+	patterns := []string{
+		"/files/:name.:ext",
+		"/files/:name",
+		"/v:version/users",
+		"/v:version/users/:id<int>-:slug",
+		"/img/:w x :h.png",
+		"/doc/:name.html",
+		"/raw/:name.:ext/*path",
+	}
+	for _, p := range patterns {
+		tt.AssertNil(rt.AddFuncHandler(p, GET, EmptyHandlerFunc), p)
+	}
+	for _, p := range []string{"/a/:x:y", "/a/*x.y", "/a/:x<int", "/a/x|y"} {
+		tt.AssertTrue(rt.AddFuncHandler(p, GET, EmptyHandlerFunc) != nil, p)
+	}
+
+	for _, c := range []struct {
+		path   string
+		values map[string]string
+	}{
+		{"/files/a.tar.gz", map[string]string{"name": "a", "ext": "tar.gz"}},
+		{"/files/readme", map[string]string{"name": "readme"}},
+		{"/files/.bashrc", map[string]string{"name": ".bashrc"}},
+		{"/v2/users", map[string]string{"version": "2"}},
+		{"/v2/users/10-john-doe", map[string]string{"version": "2", "id": "10", "slug": "john-doe"}},
+		{"/v2/users/john-doe", nil},
+		{"/img/10 x 20.png", map[string]string{"w": "10", "h": "20"}},
+		{"/img/10x20.png", nil},
+		{"/doc/my.notes.html", map[string]string{"name": "my.notes"}},
+		{"/doc/.html", nil},
+		{"/raw/a.txt/b/c", map[string]string{"name": "a", "ext": "txt", "path": "b/c"}},
+	} {
+		h, indexer, _ := rt.MatchHandlerFilters(&url.URL{Path: c.path})
+		if c.values == nil {
+			tt.AssertTrue(h == nil, c.path)
+			continue
+		}
+		tt.AssertTrue(h != nil, c.path)
+		for name, value := range c.values {
+			tt.AssertEq(indexer.URLVar(name), value, c.path, name)
+		}
+	}
+}
+
+func TestBacktrack(t *testing.T) {
+	tt := test.WrapTest(t)
+	rt := NewRouter()
+	filters := []string{}
+	filter := func(name string) FilterFunc {
+		return func(req Request, resp Response, chain FilterChain) {
+			filters = append(filters, name)
+			chain(req, resp)
+		}
+	}
+	tt.AssertNil(rt.Get("/user/new/edit", EmptyHandlerFunc))
+	tt.AssertNil(rt.Get("/user/:id/delete", EmptyHandlerFunc))
+	tt.AssertNil(rt.Get("/user/:id/:action", EmptyHandlerFunc))
+	tt.AssertNil(rt.AddFuncFilter("/user", filter("user")))
+	tt.AssertNil(rt.AddFuncFilter("/user/new", filter("new")))
+	tt.AssertNil(rt.AddFuncFilter("/user/:id", filter("id")))
+	tt.AssertNil(rt.Get("/files/ab/x", EmptyHandlerFunc))
+	tt.AssertNil(rt.Get("/files/abc", EmptyHandlerFunc))
+	tt.AssertNil(rt.Get("/files/:id", EmptyHandlerFunc))
+
+	for path, expect := range map[string][]string{
+		"/user/new/edit":   {"user", "new"},
+		"/user/new/delete": {"user", "id"},
+		"/user/12/delete":  {"user", "id"},
+		"/user/new/view":   {"user", "id"},
+		"/files/ab":        {},
+	} {
+		h, _, fs := rt.MatchHandlerFilters(&url.URL{Path: path})
+		tt.AssertTrue(h != nil, path)
+		filters = filters[:0]
+		for _, f := range fs {
+			f.Filter(nil, nil, func(Request, Response) {})
+		}
+		tt.AssertEq(filters, expect, path)
+	}
+	_, indexer, _ := rt.MatchHandlerFilters(&url.URL{Path: "/files/ab"})
+	tt.AssertEq(indexer.URLVar("id"), "ab")
+}
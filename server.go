@@ -1,10 +1,16 @@
 package zerver
 
 import (
+	"context"
+	"crypto/tls"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
 
 	websocket "github.com/cosiner/zerver_websocket"
 
@@ -19,24 +25,106 @@ type (
 		RootFilters RootFilters // Match Every Routes
 		checker     websocket.HeaderChecker
 		ContentType string // default content type
+		// FormMemory is the max bytes of multipart form stored in memory, the
+		// rest files are stored in temporary files, default DefaultFormMemory
+		FormMemory int64
+		// FormMaxSize limit the size of request body when parse form or bind
+		// json and xml body, it's also the limit of temporary files, default
+		// DefaultFormMaxSize, negative means no limit
+		FormMaxSize int64
+		// CookieCodec sign and encrypt cookies, it's required by signed and
+		// secure cookies
+		CookieCodec *CookieCodec
+		// CookieSecure make cookies always Secure, such as server is behind
+		// a https proxy, otherwise only cookies of https requests are Secure
+		CookieSecure bool
+		// RecoverHandler is called with every recovered panic, include the
+		// panics of task and websocket handlers which have no response to
+		// report, default use DefaultRecoverHandler
+		RecoverHandler RecoverHandler
+		// PanicHandler is called after RecoverHandler when handler or filter
+		// panic to report the response, the request environment will always
+		// be recycled after it, default use DefaultPanicHandler
+		PanicHandler PanicHandler
+		// ErrorHandler convert error returned by ErrHandlerFunc to response,
+		// default use DefaultErrorHandler
+		ErrorHandler ErrorHandler
+
+		components    components
+		startHooks    []func(*Server) error
+		readyHooks    []func(*Server)
+		shutdownHooks []func(*Server)
+
+		server       *http.Server
+		inflight     inflight
+		shutdownOnce sync.Once
+		closeOnce    sync.Once
+		closed       chan struct{} // closed after shutdown finished
+	}
+
+	// inflight count running websocket handlers, tasks and timeout handlers,
+	// http.Server don't known them after connection is hijacked, they are
+	// started by StartTask or they outlive the request
+	inflight struct {
+		sync.Mutex
+		count   int
+		closing bool
+		started bool // server is serving, it's destroyed by Shutdown
+		idle    chan struct{}
 	}
 
 	// HeaderChecker is a http header checker, it accept a function which can get
 	// any httper's value, it there is something wrong, throw an error
 	HeaderChecker func(header func(string) string) error
 
+	// PanicHandler handle the panic of handler or filter, value is the recovered
+	// value, stack is the stack of goroutine when panic
+	PanicHandler func(req Request, resp Response, value interface{}, stack []byte)
+
+	// RecoverHandler handle a recovered panic, source describe where the panic
+	// happened, such as "GET /path", "TASK /path" and "WebSocket /path"
+	RecoverHandler func(source string, value interface{}, stack []byte)
+
 	// ServerInitializer is a Object which will automaticlly initialed by server if
 	// it's added to server, else it should initialed manually
 	ServerInitializer interface {
 		Init(s *Server) error
 	}
 
+	// ServerConfig is the config of underlying http.Server, zero value of each
+	// field means use the default of http.Server
+	ServerConfig struct {
+		// ListenAddr is the address to listen, ignored if Listener is not nil
+		ListenAddr string
+		// Listener is the listener to serve on
+		Listener net.Listener
+
+		// CertFile and KeyFile is certificate and key file for https,
+		// if both empty and TLSConfig is nil, server will start as http server,
+		// otherwise https server
+		CertFile  string
+		KeyFile   string
+		TLSConfig *tls.Config
+
+		ReadTimeout       time.Duration
+		ReadHeaderTimeout time.Duration
+		WriteTimeout      time.Duration
+		IdleTimeout       time.Duration
+		MaxHeaderBytes    int
+		ErrorLog          *log.Logger
+	}
+
 	// serverGetter is a server getter
 	serverGetter interface {
 		Server() *Server
 	}
 )
 
+const (
+	ErrServerShutdown = Err("Server is shutting down")
+	ErrTaskRejected   = Err("Task is rejected by filters")
+)
+
 // NewServer create a new server
 func NewServer() *Server {
 	return NewServerWith(nil, nil)
@@ -54,6 +142,7 @@ func NewServerWith(rt Router, filters RootFilters) *Server {
 		Router:        rt,
 		AttrContainer: NewLockedAttrContainer(),
 		RootFilters:   filters,
+		closed:        make(chan struct{}),
 	}
 }
 
@@ -62,49 +151,239 @@ func (s *Server) Server() *Server {
 	return s
 }
 
-// Start start server
-func (s *Server) start() {
+// start init all components, root filters, handlers, filters, then call all
+// OnStart hooks, if any error happend, it's returned and inited components
+// will be destroyed
+func (s *Server) start() (err error) {
 	if s.ContentType == "" {
 		s.ContentType = CONTENTTYPE_JSON
 	}
-	OnErrPanic(s.RootFilters.Init(s))
+	if err = s.components.init(s); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			s.components.destroy()
+		}
+	}()
+	if err = s.RootFilters.Init(s); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			s.RootFilters.Destroy()
+		}
+	}()
 	log.Println("Init Handlers and Filters")
+	// routes added while serving are inited by live initializer, the router
+	// may still call initialize later if it's not a LiveRouter, only what
+	// inited during start is recorded to be destroyed if start failed
+	if lr, is := s.Router.(LiveRouter); is {
+		lr.SetLiveInitializer(func(i ServerInitializer) error {
+			return i.Init(s)
+		})
+	}
+	var (
+		starting = true
+		inited   []interface {
+			Destroy()
+		}
+	)
+	initialize := func(i interface {
+		ServerInitializer
+		Destroy()
+	}) bool {
+		e := i.Init(s)
+		if !starting {
+			return e == nil
+		}
+		if e != nil && err == nil {
+			err = e
+		}
+		if e == nil {
+			inited = append(inited, i)
+		}
+		return e == nil
+	}
 	s.Router.Init(func(handler Handler) bool {
-		OnErrPanic(handler.Init(s))
-		return true
+		return initialize(handler)
 	}, func(filter Filter) bool {
-		OnErrPanic(filter.Init(s))
-		return true
+		return initialize(filter)
 	}, func(websocketHandler WebSocketHandler) bool {
-		OnErrPanic(websocketHandler.Init(s))
-		return true
+		return initialize(websocketHandler)
 	}, func(taskHandler TaskHandler) bool {
-		OnErrPanic(taskHandler.Init(s))
-		return true
+		return initialize(taskHandler)
 	})
+	starting = false
+	if err != nil {
+		for i := len(inited) - 1; i >= 0; i-- {
+			inited[i].Destroy()
+		}
+		return
+	}
+	inited = nil
+	defer func() {
+		if err != nil {
+			s.Router.Destroy()
+		}
+	}()
+	for _, hook := range s.startHooks {
+		if err = hook(s); err != nil {
+			return
+		}
+	}
 	log.Println("Server Start")
 	// destroy temporary data store
 	tmpDestroy()
 	runtime.GC()
+	return
+}
+
+// AddComponent add a component with name and the names of components it
+// depends on, components are inited before all filters and handlers, dependencies
+// is always inited before it, and destroyed after it
+func (s *Server) AddComponent(name string, c Component, deps ...string) error {
+	return s.components.add(name, c, deps)
+}
+
+// Component return component by name, nil if not exist
+func (s *Server) Component(name string) Component {
+	return s.components.get(name)
+}
+
+// OnStart add a hook called after all components, filters and handlers are
+// inited, before server start listening, if it return an error, server will not
+// start and the error is returned by Start
+func (s *Server) OnStart(fn func(*Server) error) {
+	s.startHooks = append(s.startHooks, fn)
+}
+
+// OnReady add a hook called after server is listening, before serving
+// any request
+func (s *Server) OnReady(fn func(*Server)) {
+	s.readyHooks = append(s.readyHooks, fn)
+}
+
+// OnShutdown add a hook called when Shutdown is first called, before waiting
+// in-flight requests, it's the place to deregister from service discovery or
+// notify long-running handlers to exit
+func (s *Server) OnShutdown(fn func(*Server)) {
+	s.shutdownHooks = append(s.shutdownHooks, fn)
 }
 
 // Start start server as http server
 func (s *Server) Start(listenAddr string) error {
-	s.start()
-	return http.ListenAndServe(listenAddr, s)
+	return s.StartWith(&ServerConfig{ListenAddr: listenAddr})
+}
+
+// StartTLS start server as https server
+func (s *Server) StartTLS(listenAddr, certFile, keyFile string) error {
+	return s.StartWith(&ServerConfig{
+		ListenAddr: listenAddr,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+	})
+}
+
+// Serve start server on given listener, such as unix domain socket listener or
+// listener passed by supervisor
+func (s *Server) Serve(l net.Listener) error {
+	return s.StartWith(&ServerConfig{Listener: l})
+}
+
+// StartWith start server with given config
+func (s *Server) StartWith(conf *ServerConfig) error {
+	if conf == nil {
+		conf = &ServerConfig{}
+	}
+	// starting is counted as in-flight, Shutdown wait until it's done, then
+	// destroy server only if it's started, otherwise it's destroyed here
+	if !s.inflight.enter() {
+		return ErrServerShutdown
+	}
+	if err := s.start(); err != nil {
+		s.inflight.leave()
+		return err
+	}
+	l, err := conf.listen()
+	if err != nil {
+		s.Destroy()
+		s.inflight.leave()
+		return err
+	}
+	srv := conf.httpServer(s)
+	s.inflight.Lock()
+	closing := s.inflight.closing
+	if !closing {
+		s.server, s.inflight.started = srv, true
+	}
+	s.inflight.Unlock()
+	if closing {
+		l.Close()
+		s.Destroy()
+		s.inflight.leave()
+		return ErrServerShutdown
+	}
+	s.inflight.leave()
+	for _, hook := range s.readyHooks {
+		hook(s)
+	}
+	err = conf.serve(srv, l)
+	if err == http.ErrServerClosed { // stopped by Shutdown, wait it finished
+		<-s.closed
+		err = nil
+	}
+	return err
 }
 
-// Destroy is mainly designed to stop server, release all resources
-// but it seems ther is no approach to stop a running golang but don't exit process
+// Shutdown gracefully stop server: call OnShutdown hooks, stop accepting new
+// connections, wait for in-flight http requests, websocket handlers and tasks
+// started by StartTask to finish, then destroy root filters, router and
+// components if server is started. If server is starting, wait it finished,
+// it will be destroyed by the starting side instead.
+//
+// If context is done before all of them finished, the context error is returned
+// and nothing will be destroyed, for there may be some handlers still using them,
+// it's safe to call Shutdown again to continue waiting
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.inflight.Lock()
+	s.inflight.closing = true
+	srv := s.server
+	s.inflight.Unlock()
+	s.shutdownOnce.Do(func() {
+		for _, hook := range s.shutdownHooks {
+			hook(s)
+		}
+	})
+
+	var err error
+	if srv != nil {
+		err = srv.Shutdown(ctx)
+	}
+	if err == nil {
+		err = s.inflight.wait(ctx)
+	}
+	if err == nil {
+		s.inflight.Lock()
+		started := s.inflight.started
+		s.inflight.Unlock()
+		s.closeOnce.Do(func() {
+			if started {
+				s.Destroy()
+			}
+			close(s.closed)
+		})
+	}
+	return err
+}
+
+// Destroy release all resources hold by root filters, router and components,
+// root filters is destroyed first, components is the last. It should only be
+// called after server stopped, commonly use Shutdown instead
 func (s *Server) Destroy() {
 	s.RootFilters.Destroy()
 	s.Router.Destroy()
-}
-
-// StartTLS start server as https server
-func (s *Server) StartTLS(listenAddr, certFile, keyFile string) error {
-	s.start()
-	return http.ListenAndServeTLS(listenAddr, certFile, keyFile, s)
+	s.components.destroy()
 }
 
 // ServHttp serve for http reuest
@@ -118,13 +397,45 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, request *http.Request) {
 }
 
 // StartTask add a task
-// Task must have corresponding handler, otherwise server will panic
-func (s *Server) StartTask(async bool, path string, value interface{}) {
+// Task must have corresponding handler, otherwise an error is returned,
+// if server is shutting down, task will be rejected with ErrServerShutdown.
+// Route filters are run before task is handled with a request of method TASK,
+// if they don't continue the chain, the task is dropped, for synchronous task,
+// ErrTaskRejected is returned
+func (s *Server) StartTask(async bool, path string, value interface{}) error {
+	return s.StartTaskContext(context.Background(), async, path, value)
+}
+
+// StartTaskContext is same as StartTask, but task will inherit given context,
+// NOTICE: if it's a request's context and task is asynchronous, it may be
+// canceled after request finished
+func (s *Server) StartTaskContext(ctx context.Context, async bool, path string, value interface{}) error {
+	if !s.inflight.enter() {
+		return ErrServerShutdown
+	}
+	var (
+		handler TaskHandler
+		indexer URLVarIndexer
+		filters []Filter
+	)
+	u, err := url.Parse(path)
+	if err == nil {
+		if handler, indexer, filters = s.MatchTaskHandler(u); handler == nil {
+			indexer.destroySelf()
+			err = Err("No task handler found for " + path)
+		}
+	}
+	if err != nil {
+		s.inflight.leave()
+		return err
+	}
+	task := newTask(s, ctx, indexer, value)
 	if async {
-		go s.serveTask(path, value)
-	} else {
-		s.serveTask(path, value)
+		go s.serveTask(handler, task, u, filters)
+	} else if !s.serveTask(handler, task, u, filters) {
+		return ErrTaskRejected
 	}
+	return nil
 }
 
 // SetWebSocketHeaderChecker accept a checker function, checker can get an
@@ -132,54 +443,331 @@ func (s *Server) SetWebSocketHeaderChecker(checker HeaderChecker) {
 	s.checker.Checker = checker
 }
 
-// serveWebSocket serve for websocket protocal
+// serveWebSocket serve for websocket protocal, route filters are run before
+// connection upgraded. If there is no websocket handler for the url, request
+// is served as normal http request, so handlers such as proxy can process the
+// upgrade themselves
 func (s *Server) serveWebSocket(w http.ResponseWriter, request *http.Request) {
-	handler, indexer := s.MatchWebSocketHandler(request.URL)
+	url := *request.URL
+	url.Host = request.Host
+	handler, indexer, filters := s.MatchWebSocketHandler(&url)
 	if handler == nil {
-		w.WriteHeader(http.StatusNotFound)
-	} else if conn, err := websocket.UpgradeWebsocket(w, request, s.checker.HandshakeCheck); err == nil {
-		handler.Handle(newWebSocketConn(s, conn, indexer))
 		indexer.destroySelf()
+		s.serveHTTP(w, request)
+		return
+	}
+	if !s.inflight.enter() {
+		indexer.destroySelf()
+		Pool.recycleFilters(filters)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
 	}
+	defer s.inflight.leave()
+	s.filter(w, request, indexer, filters, func(req Request, resp Response) {
+		request := req.Raw()
+		conn, err := websocket.UpgradeWebsocket(responseWriter{resp}, request, s.checker.HandshakeCheck)
+		if err != nil {
+			return
+		}
+		defer func() {
+			if e := recover(); e != nil {
+				// connection is in unknown state, close it
+				conn.Close()
+				s.recoverPanic("WebSocket "+request.URL.Path, e, debug.Stack())
+			}
+		}()
+		handler.Handle(newWebSocketConn(s, conn, indexer))
+	})
+}
+
+// filter run route filters for websocket and task, handler is the end of chain,
+// request environment is recycled after chain returned
+func (s *Server) filter(w http.ResponseWriter, request *http.Request,
+	indexer URLVarIndexer, filters []Filter, handler HandlerFunc) {
+	env := Pool.newRequestEnv()
+	req, resp := env.req.init(s, w, request, indexer), env.resp.init(s, w, request.TLS != nil)
+	defer func() {
+		if e := recover(); e != nil {
+			s.handlePanic(req, resp, e)
+		}
+		req.destroy()
+		resp.destroy()
+		env.routeChain.destroy()
+		Pool.recycleRequestEnv(env)
+		Pool.recycleFilters(filters)
+	}()
+	env.routeChain.init(filters, handler)
+	env.routeChain.handleChain(req, resp)
 }
 
 // serveHTTP serve for http protocal
 func (s *Server) serveHTTP(w http.ResponseWriter, request *http.Request) {
-	url := request.URL
+	url := *request.URL
 	url.Host = request.Host
-	handler, indexer, filters := s.MatchHandlerFilters(url)
-	requestEnv := Pool.newRequestEnv()
-	req, resp := requestEnv.req.init(s, request, indexer), requestEnv.resp.init(w)
+	handler, indexer, filters := s.MatchHandlerFilters(&url)
+	if timeout := routeTimeout(indexer); timeout > 0 {
+		s.serveHTTPTimeout(w, request, &url, timeout, handler, indexer, filters)
+	} else {
+		s.dispatch(w, request, &url, handler, indexer, filters)
+	}
+}
+
+// dispatch run root filters, route filters and handler, request environment is
+// always recycled after them, even there is a panic. url is the request url
+// with host, it's used to choose root filters
+func (s *Server) dispatch(w http.ResponseWriter, request *http.Request, url *url.URL,
+	handler Handler, indexer URLVarIndexer, filters []Filter) {
+	env := Pool.newRequestEnv()
+	req, resp := env.req.init(s, w, request, indexer), env.resp.init(s, w, request.TLS != nil)
+	defer func() {
+		if e := recover(); e != nil {
+			s.handlePanic(req, resp, e)
+		}
+		req.destroy()
+		resp.destroy()
+		env.rootChain.destroy()
+		env.routeChain.destroy()
+		Pool.recycleRequestEnv(env)
+		Pool.recycleFilters(filters)
+	}()
 	resp.SetContentType(s.ContentType)
-	var chain FilterChain
+	var (
+		handlerFunc HandlerFunc
+		method      = req.Method()
+	)
+	env.resp.discardBody = method == HEAD
 	if handler == nil {
 		resp.ReportNotFound()
-	} else if chain = FilterChain(indicateHandler(req.Method(), handler)); chain == nil {
+	} else if handlerFunc = indicateHandler(method, handler); handlerFunc == nil {
+		resp.SetHeader(HEADER_ALLOW, allowedMethods(handler))
 		resp.ReportMethodNotAllowed()
 	}
-	newFilterChain(s.RootFilters.Filters(url), newFilterChain(filters, chain))(req, resp)
-	req.destroy()
-	resp.destroy()
-	Pool.recycleRequestEnv(requestEnv)
-	Pool.recycleFilters(filters)
+	env.routeChain.init(filters, handlerFunc)
+	env.rootChain.init(s.RootFilters.Filters(url), env.routeChain.handleChain)
+	env.rootChain.handleChain(req, resp)
+	// handler such as EmptyHandler may also report 405
+	if handler != nil && resp.Status() == http.StatusMethodNotAllowed &&
+		env.resp.header.Get(HEADER_ALLOW) == "" {
+		resp.SetHeader(HEADER_ALLOW, allowedMethods(handler))
+	}
 }
 
-// serveTask serve for asynchronous task
-func (s *Server) serveTask(path string, value interface{}) {
-	u, err := url.Parse(path)
-	if err != nil {
-		PanicServer(err.Error())
+// serveHTTPTimeout dispatch request in a new goroutine with a timeout context,
+// response is buffered until dispatch finished. If timeout, 503 is sent to
+// client, the goroutine keeps running until handler return, then recycle the
+// request environment itself, all writes after timeout are discarded
+func (s *Server) serveHTTPTimeout(w http.ResponseWriter, request *http.Request, url *url.URL,
+	timeout time.Duration, handler Handler, indexer URLVarIndexer, filters []Filter) {
+	ctx, cancel := context.WithTimeout(request.Context(), timeout)
+	defer cancel()
+	request = request.WithContext(ctx)
+	tw := newTimeoutWriter(ctx)
+	done := make(chan struct{})
+	s.inflight.hold()
+	go func() {
+		defer s.inflight.leave()
+		s.dispatch(tw, request, url, handler, indexer, filters)
+		tw.finish()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if !tw.timeout() {
+			<-done
+		}
+	}
+	// handler may notice context done and finish before us, it's also timeout
+	// if it wrote after that
+	if ctx.Err() != nil && tw.timeout() {
+		if ctx.Err() == context.DeadlineExceeded {
+			w.Header().Set(HEADER_CONTENTTYPE, CONTNTTYPE_PLAIN)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(http.StatusText(http.StatusServiceUnavailable)))
+		}
+		return
+	}
+	tw.writeTo(w)
+}
+
+// serveTask serve for asynchronous task, if there are route filters, task is
+// handled at the end of filter chain with the context of request
+func (s *Server) serveTask(handler TaskHandler, task Task, u *url.URL, filters []Filter) (handled bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			s.recoverPanic(TASK+" "+u.Path, e, debug.Stack())
+		}
+		task.destroy()
+		s.inflight.leave()
+	}()
+	if len(filters) == 0 {
+		Pool.recycleFilters(filters)
+		handled = true
+		handler.Handle(task)
+		return
 	}
-	handler, indexer := s.MatchTaskHandler(u)
+	request := &http.Request{
+		Method: TASK,
+		URL:    u,
+		Host:   u.Host,
+		Header: make(http.Header),
+	}
+	request = request.WithContext(task.Context())
+	// request own a copy of url variables, it's destroyed after filters
+	s.filter(newTaskResponseWriter(), request, task.varIndexer().clone(), filters,
+		func(req Request, _ Response) {
+			task.WithContext(req.Context())
+			handled = true
+			handler.Handle(task)
+		})
+	return
+}
+
+// handlePanic pass the panic value and stack to RecoverHandler, then to
+// PanicHandler to report the response
+func (s *Server) handlePanic(req Request, resp Response, value interface{}) {
+	stack := debug.Stack()
+	s.recoverPanic(req.Method()+" "+req.URL().Path, value, stack)
+	defer func() {
+		if e := recover(); e != nil {
+			s.recoverPanic("PanicHandler", e, debug.Stack())
+		}
+	}()
+	handler := s.PanicHandler
+	if handler == nil {
+		handler = DefaultPanicHandler
+	}
+	handler(req, resp, value, stack)
+}
+
+// recoverPanic pass a recovered panic to RecoverHandler, if RecoverHandler
+// also panic, it will be logged
+func (s *Server) recoverPanic(source string, value interface{}, stack []byte) {
+	defer func() {
+		if e := recover(); e != nil {
+			logPanic("RecoverHandler", e)
+		}
+	}()
+	handler := s.RecoverHandler
 	if handler == nil {
-		PanicServer("No task handler found for " + path)
+		handler = DefaultRecoverHandler
 	}
-	task := newTask(s, indexer, value)
-	handler.Handle(task)
-	task.destroy()
+	handler(source, value, stack)
 }
 
-// PanicServer create a new goroutine, it force panic whole process
+// DefaultRecoverHandler log the panic value and stack
+func DefaultRecoverHandler(source string, value interface{}, stack []byte) {
+	log.Printf("Panic when serve %s: %v\n%s", source, value, stack)
+}
+
+// DefaultPanicHandler report 500, the panic is already passed to
+// RecoverHandler
+func DefaultPanicHandler(req Request, resp Response, value interface{}, stack []byte) {
+	resp.ReportInternalServerError()
+}
+
+// logPanic log panic value and current stack with given prefix
+func logPanic(prefix string, value interface{}) {
+	log.Printf("%s panic: %v\n%s", prefix, value, debug.Stack())
+}
+
+// PanicServer panic with given message, it will be recovered by server if
+// it's called in request handling, otherwise it will stop the process like
+// normal panic
 func PanicServer(s string) {
-	go panic(s)
+	panic(s)
+}
+
+// httpServer create a http.Server serve for given handler
+func (conf *ServerConfig) httpServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              conf.ListenAddr,
+		Handler:           handler,
+		TLSConfig:         conf.TLSConfig,
+		ReadTimeout:       conf.ReadTimeout,
+		ReadHeaderTimeout: conf.ReadHeaderTimeout,
+		WriteTimeout:      conf.WriteTimeout,
+		IdleTimeout:       conf.IdleTimeout,
+		MaxHeaderBytes:    conf.MaxHeaderBytes,
+		ErrorLog:          conf.ErrorLog,
+	}
+}
+
+// listen return Listener if it's not nil, otherwise listen on ListenAddr
+func (conf *ServerConfig) listen() (net.Listener, error) {
+	if conf.Listener != nil {
+		return conf.Listener, nil
+	}
+	addr := conf.ListenAddr
+	if addr == "" {
+		if conf.isTLS() {
+			addr = ":https"
+		} else {
+			addr = ":http"
+		}
+	}
+	return net.Listen("tcp", addr)
+}
+
+// isTLS check whether server should start as https server
+func (conf *ServerConfig) isTLS() bool {
+	return conf.CertFile != "" || conf.KeyFile != "" || conf.TLSConfig != nil
+}
+
+// serve start http server as http or https server on listener
+func (conf *ServerConfig) serve(srv *http.Server, l net.Listener) error {
+	if conf.isTLS() {
+		return srv.ServeTLS(l, conf.CertFile, conf.KeyFile)
+	}
+	return srv.Serve(l)
+}
+
+// enter mark a websocket handler or task started, if server is shutting down,
+// false is returned
+func (f *inflight) enter() bool {
+	f.Lock()
+	ok := !f.closing
+	if ok {
+		f.count++
+	}
+	f.Unlock()
+	return ok
+}
+
+// hold mark a goroutine still running, it's not rejected even server is
+// shutting down, it's used for those goroutines outlive their http request
+func (f *inflight) hold() {
+	f.Lock()
+	f.count++
+	f.Unlock()
+}
+
+// leave mark a websocket handler or task finished
+func (f *inflight) leave() {
+	f.Lock()
+	if f.count--; f.count == 0 && f.idle != nil {
+		close(f.idle)
+		f.idle = nil
+	}
+	f.Unlock()
+}
+
+// wait wait until all websocket handlers and tasks finished or context done
+func (f *inflight) wait(ctx context.Context) error {
+	f.Lock()
+	if f.count == 0 {
+		f.Unlock()
+		return nil
+	}
+	if f.idle == nil {
+		f.idle = make(chan struct{})
+	}
+	idle := f.idle
+	f.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
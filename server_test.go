@@ -0,0 +1,783 @@
+package zerver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cosiner/golib/test"
+
+	. "github.com/cosiner/golib/errors"
+)
+
+func TestServeAndShutdown(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	s.Get("/slow", func(req Request, resp Response) {
+		time.Sleep(100 * time.Millisecond)
+		resp.Write([]byte("done"))
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	tt.AssertNil(err)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(l)
+	}()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String() + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		body <- string(data)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	tt.AssertNil(s.Shutdown(context.Background()))
+	tt.AssertTrue(<-body == "done")
+	tt.AssertNil(<-served)
+	tt.AssertTrue(s.StartTask(false, "/task", nil) == ErrServerShutdown)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	var (
+		recovered interface{}
+		sources   []string
+	)
+	s.RecoverHandler = func(source string, value interface{}, stack []byte) {
+		sources = append(sources, source)
+	}
+	s.PanicHandler = func(req Request, resp Response, value interface{}, stack []byte) {
+		recovered = value
+		DefaultPanicHandler(req, resp, value, stack)
+	}
+	s.AddFuncFilter("/panic", EmptyFilterFunc)
+	s.AddOptionHandler("/panic", &OptionHandler{
+		Get: func(Request, Response) {
+			panic("boom")
+		},
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	tt.AssertTrue(w.Code == http.StatusInternalServerError)
+	tt.AssertTrue(recovered == "boom")
+
+	recovered = nil
+	s.AddFuncTaskHandler("/panic", func(Task) {
+		panic("task boom")
+	})
+	tt.AssertNil(s.StartTask(false, "/panic", nil))
+	tt.AssertTrue(recovered == "task boom")
+
+	// task without filters has no request to pass to PanicHandler
+	s.AddFuncTaskHandler("/bare", func(Task) {
+		panic("bare boom")
+	})
+	tt.AssertNil(s.StartTask(false, "/bare", nil))
+	tt.AssertEq(strings.Join(sources, ","), "GET /panic,TASK /panic,TASK /bare")
+	// the task left the server, shutdown needn't wait for it
+	tt.AssertNil(s.Shutdown(context.Background()))
+}
+
+func TestErrorHandler(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	s.ContentType = CONTENTTYPE_JSON
+	s.AddOptionHandler("/error", &OptionHandler{
+		Get: HandleError(func(Request, Response) error {
+			return NewHTTPError(http.StatusConflict, 10, "user exists")
+		}),
+		Post: HandleError(func(Request, Response) error {
+			return Err("database down")
+		}),
+		Put: HandleError(func(Request, Response) error {
+			return &HTTPError{Message: "no status"}
+		}),
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/error", nil))
+	tt.AssertTrue(w.Code == http.StatusConflict)
+	tt.AssertTrue(strings.TrimSpace(w.Body.String()) == `{"code":10,"message":"user exists"}`)
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("POST", "/error", nil))
+	tt.AssertTrue(w.Code == http.StatusInternalServerError)
+	tt.AssertTrue(!strings.Contains(w.Body.String(), "database"))
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("PUT", "/error", nil))
+	tt.AssertTrue(w.Code == http.StatusInternalServerError)
+	tt.AssertTrue(strings.TrimSpace(w.Body.String()) == `{"message":"no status"}`)
+}
+
+type ctxKey struct{}
+
+func TestRequestContext(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	var value interface{}
+	s.AddFuncFilter("/ctx", func(req Request, resp Response, chain FilterChain) {
+		req.WithContext(context.WithValue(req.Context(), ctxKey{}, "filter"))
+		chain(req, resp)
+	})
+	s.AddOptionHandler("/ctx", &OptionHandler{
+		Get: func(req Request, resp Response) {
+			value = req.Context().Value(ctxKey{})
+		},
+	})
+
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ctx", nil))
+	tt.AssertTrue(value == "filter")
+}
+
+func TestRouteTimeout(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	tt.AssertNil(s.SetTimeout("/slow", 50*time.Millisecond))
+	writeErr := make(chan error, 1)
+	s.AddOptionHandler("/slow/:id", &OptionHandler{
+		Get: func(req Request, resp Response) {
+			<-req.Context().Done()
+			_, err := resp.Write([]byte("late"))
+			writeErr <- err
+		},
+	})
+	s.AddOptionHandler("/fast", &OptionHandler{
+		Get: func(req Request, resp Response) {
+			resp.ReportCreated()
+			resp.Write([]byte("fast"))
+		},
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/slow/1", nil))
+	tt.AssertTrue(w.Code == http.StatusServiceUnavailable)
+	tt.AssertTrue(<-writeErr == ErrHandlerTimeout)
+
+	tt.AssertNil(s.SetTimeout("/fast", time.Second))
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/fast", nil))
+	tt.AssertTrue(w.Code == http.StatusCreated)
+	tt.AssertTrue(w.Body.String() == "fast")
+}
+
+type orderComponent struct {
+	name   string
+	order  *[]string
+	failed bool
+}
+
+func (c orderComponent) Init(*Server) error {
+	if c.failed {
+		return Err("init failed")
+	}
+	*c.order = append(*c.order, "init "+c.name)
+	return nil
+}
+
+func (c orderComponent) Destroy() {
+	*c.order = append(*c.order, "destroy "+c.name)
+}
+
+func TestComponentOrder(t *testing.T) {
+	tt := test.WrapTest(t)
+	var order []string
+	s := NewServer()
+	tt.AssertNil(s.AddComponent("session", orderComponent{name: "session", order: &order}, "cache", "db"))
+	tt.AssertNil(s.AddComponent("cache", orderComponent{name: "cache", order: &order}, "db"))
+	tt.AssertNil(s.AddComponent("db", orderComponent{name: "db", order: &order}))
+	tt.AssertTrue(s.AddComponent("db", orderComponent{}) == ErrComponentExist)
+	s.OnStart(func(*Server) error {
+		order = append(order, "start")
+		return nil
+	})
+	s.OnShutdown(func(*Server) {
+		order = append(order, "shutdown")
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	tt.AssertNil(err)
+	ready := make(chan struct{})
+	s.OnReady(func(*Server) {
+		close(ready)
+	})
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(l)
+	}()
+	<-ready
+	tt.AssertNil(s.Shutdown(context.Background()))
+	tt.AssertNil(<-served)
+	tt.AssertEq(order, []string{
+		"init db", "init cache", "init session", "start",
+		"shutdown", "destroy session", "destroy cache", "destroy db",
+	})
+}
+
+func TestStartError(t *testing.T) {
+	tt := test.WrapTest(t)
+	var order []string
+	s := NewServer()
+	s.AddComponent("db", orderComponent{name: "db", order: &order})
+	s.AddComponent("cache", orderComponent{name: "cache", failed: true}, "db")
+	tt.AssertTrue(s.Start("127.0.0.1:0") != nil)
+	tt.AssertEq(order, []string{"init db", "destroy db"})
+
+	s = NewServer()
+	s.AddComponent("cache", orderComponent{name: "cache"}, "db")
+	tt.AssertTrue(s.Start("127.0.0.1:0") != nil)
+
+	order = nil
+	s = NewServer()
+	s.AddComponent("db", orderComponent{name: "db", order: &order})
+	s.RootFilters.AddFilter(orderFilter{orderComponent{name: "root", order: &order}})
+	s.AddFilter("/a", orderFilter{orderComponent{name: "a", order: &order}})
+	s.AddFilter("/a/b", orderFilter{orderComponent{name: "b", failed: true}})
+	tt.AssertTrue(s.Start("127.0.0.1:0") != nil)
+	tt.AssertEq(order, []string{
+		"init db", "init root", "init a",
+		"destroy a", "destroy root", "destroy db",
+	})
+
+	order = nil
+	s = NewServer()
+	s.AddComponent("db", orderComponent{name: "db", order: &order})
+	tt.AssertTrue(s.Start("127.0.0.1:-1") != nil)
+	tt.AssertEq(order, []string{"init db", "destroy db"})
+}
+
+func TestShutdownWhileStarting(t *testing.T) {
+	tt := test.WrapTest(t)
+	var order []string
+	s := NewServer()
+	s.AddComponent("db", orderComponent{name: "db", order: &order})
+	tt.AssertNil(s.Shutdown(context.Background()))
+	tt.AssertTrue(s.Start("127.0.0.1:0") == ErrServerShutdown)
+	tt.AssertEq(len(order), 0)
+
+	s = NewServer()
+	s.AddComponent("db", orderComponent{name: "db", order: &order})
+	starting, release := make(chan struct{}), make(chan struct{})
+	s.OnStart(func(*Server) error {
+		close(starting)
+		<-release
+		return nil
+	})
+	s.OnShutdown(func(*Server) {
+		close(release)
+	})
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Start("127.0.0.1:0")
+	}()
+	<-starting
+	tt.AssertNil(s.Shutdown(context.Background()))
+	tt.AssertTrue(<-served == ErrServerShutdown)
+	tt.AssertEq(order, []string{"init db", "destroy db"})
+}
+
+type orderFilter struct {
+	orderComponent
+}
+
+func (orderFilter) Filter(req Request, resp Response, chain FilterChain) {
+	chain(req, resp)
+}
+
+type getHandler struct {
+	EmptyHandler
+}
+
+func (getHandler) Get(_ Request, resp Response) {
+	resp.Write([]byte("get"))
+}
+
+func (getHandler) Methods() []string {
+	return []string{GET}
+}
+
+type postHandler struct {
+	EmptyHandler
+}
+
+func (*postHandler) Post(Request, Response) {}
+
+func (*postHandler) Methods() []string {
+	return []string{POST}
+}
+
+func TestHeadAndOptions(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	s.AddOptionHandler("/user", &OptionHandler{
+		Get: func(_ Request, resp Response) {
+			resp.Write([]byte("user"))
+		},
+		Post: EmptyHandlerFunc,
+	})
+	s.AddHandler("/standard", getHandler{})
+	s.AddHandler("/pointer", &postHandler{})
+	s.AddHandler("/empty", EmptyHandler{})
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := serve("HEAD", "/user")
+	tt.AssertTrue(w.Code == http.StatusOK)
+	tt.AssertTrue(w.Body.Len() == 0)
+
+	w = serve("OPTIONS", "/user")
+	tt.AssertTrue(w.Code == http.StatusOK)
+	tt.AssertEq(w.Header().Get(HEADER_ALLOW), "GET, HEAD, POST, OPTIONS")
+
+	w = serve("PUT", "/user")
+	tt.AssertTrue(w.Code == http.StatusMethodNotAllowed)
+	tt.AssertEq(w.Header().Get(HEADER_ALLOW), "GET, HEAD, POST, OPTIONS")
+
+	w = serve("HEAD", "/standard")
+	tt.AssertTrue(w.Code == http.StatusOK)
+	tt.AssertTrue(w.Body.Len() == 0)
+
+	w = serve("PUT", "/standard")
+	tt.AssertTrue(w.Code == http.StatusMethodNotAllowed)
+	tt.AssertEq(w.Header().Get(HEADER_ALLOW), "GET, HEAD, OPTIONS")
+
+	w = serve("OPTIONS", "/standard")
+	tt.AssertTrue(w.Code == http.StatusOK)
+	tt.AssertEq(w.Header().Get(HEADER_ALLOW), "GET, HEAD, OPTIONS")
+
+	w = serve("GET", "/pointer")
+	tt.AssertTrue(w.Code == http.StatusMethodNotAllowed)
+	tt.AssertEq(w.Header().Get(HEADER_ALLOW), "POST, OPTIONS")
+
+	// handler without MethodLister is considered to support all methods
+	w = serve("OPTIONS", "/empty")
+	tt.AssertEq(w.Header().Get(HEADER_ALLOW), "GET, HEAD, POST, DELETE, PUT, PATCH, OPTIONS")
+}
+
+func TestCanonicalRedirect(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	s.Get("/users", EmptyHandlerFunc)
+	s.Post("/users", EmptyHandlerFunc)
+	s.SetRedirect(RedirectAll)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/Users/?page=2", nil))
+	tt.AssertTrue(w.Code == http.StatusMovedPermanently)
+	tt.AssertEq(w.Header().Get(HEADER_LOCATION), "/users?page=2")
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("POST", "/users/", nil))
+	tt.AssertTrue(w.Code == http.StatusPermanentRedirect)
+	tt.AssertEq(w.Header().Get(HEADER_LOCATION), "/users")
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/none", nil))
+	tt.AssertTrue(w.Code == http.StatusNotFound)
+}
+
+type countHandler struct {
+	EmptyHandler
+	inits, destroys *int32
+}
+
+func (h countHandler) Init(*Server) error {
+	atomic.AddInt32(h.inits, 1)
+	return nil
+}
+
+func (h countHandler) Get(_ Request, resp Response) {
+	resp.Write([]byte("count"))
+}
+
+func (h countHandler) Destroy() {
+	atomic.AddInt32(h.destroys, 1)
+}
+
+func TestRuntimeRoutes(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	var inits, destroys int32
+	s.Get("/static", EmptyHandlerFunc)
+	tt.AssertNil(s.start())
+
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			serve("/static")
+			serve("/tenant/1/count")
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		tt.AssertNil(s.AddHandler("/tenant/:id/count", countHandler{inits: &inits, destroys: &destroys}))
+		tt.AssertNil(s.AddFuncFilter("/tenant", EmptyFilterFunc))
+		tt.AssertTrue(serve("/tenant/1/count") == http.StatusOK)
+		tt.AssertNil(s.RemoveHandler("/tenant/:id/count"))
+		tt.AssertNil(s.RemoveFilters("/tenant"))
+		tt.AssertTrue(serve("/tenant/1/count") == http.StatusNotFound)
+	}
+	<-done
+	tt.AssertTrue(s.RemoveHandler("/tenant/:id/count") == ErrRouteNotFound)
+	tt.AssertEq(atomic.LoadInt32(&inits), int32(20))
+	tt.AssertEq(atomic.LoadInt32(&destroys), int32(20))
+	s.Destroy()
+}
+
+type blockHandler struct {
+	countHandler
+	entered, leave chan struct{}
+}
+
+func (h blockHandler) Get(_ Request, resp Response) {
+	h.entered <- struct{}{}
+	<-h.leave
+}
+
+type failFilter struct{}
+
+func (failFilter) Init(*Server) error                    { return Err("fail") }
+func (failFilter) Filter(Request, Response, FilterChain) {}
+func (failFilter) Destroy()                              {}
+
+func TestRuntimeRemoveInflight(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	tt.AssertNil(s.start())
+	defer s.Destroy()
+
+	var inits, destroys int32
+	h := blockHandler{
+		countHandler: countHandler{inits: &inits, destroys: &destroys},
+		entered:      make(chan struct{}),
+		leave:        make(chan struct{}),
+	}
+	tt.AssertNil(s.AddHandler("/block", h))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/block", nil))
+	}()
+	<-h.entered
+	tt.AssertNil(s.RemoveHandler("/block"))
+	tt.AssertEq(atomic.LoadInt32(&destroys), int32(0))
+	close(h.leave)
+	<-done
+	tt.AssertEq(atomic.LoadInt32(&destroys), int32(1))
+
+	// error of Init is returned as is
+	tt.AssertEq(s.AddFilter("/block", failFilter{}).Error(), "fail")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/block", nil))
+	tt.AssertEq(w.Code, http.StatusNotFound)
+}
+
+// routeHandler add a route for it's path when it's inited
+type routeHandler struct {
+	EmptyHandler
+	path string
+}
+
+func (h routeHandler) Init(s *Server) error {
+	return s.Get(h.path+"/added", EmptyHandlerFunc)
+}
+
+func TestRuntimeInitAddRoute(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	tt.AssertNil(s.AddHandler("/start", routeHandler{path: "/start"}))
+	started := make(chan error, 1)
+	go func() {
+		started <- s.start()
+	}()
+	select {
+	case err := <-started:
+		tt.AssertNil(err)
+	case <-time.After(time.Second):
+		t.Fatal("start blocked by Init which add route")
+	}
+	defer s.Destroy()
+
+	added := make(chan error, 1)
+	go func() {
+		added <- s.AddHandler("/runtime", routeHandler{path: "/runtime"})
+	}()
+	select {
+	case err := <-added:
+		tt.AssertNil(err)
+	case <-time.After(time.Second):
+		t.Fatal("AddHandler blocked by Init which add route")
+	}
+	for _, path := range []string{"/start/added", "/runtime/added"} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		tt.AssertEq(w.Code, http.StatusOK)
+	}
+}
+
+func TestMount(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	s.Mount("/repos/:owner/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Owner", URLVars(r)["owner"])
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(r.URL.Path))
+	}))
+
+	for path, expect := range map[string]string{
+		"/repos/cosiner":               "/",
+		"/repos/cosiner/":              "/",
+		"/repos/cosiner/zerver/issues": "/zerver/issues",
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("DELETE", path+"?a=b", nil))
+		tt.AssertEq(w.Code, http.StatusAccepted)
+		tt.AssertEq(w.Header().Get("X-Owner"), "cosiner")
+		tt.AssertEq(w.Body.String(), expect)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	mw := s.Middleware(FilterFunc(func(req Request, resp Response, chain FilterChain) {
+		if req.Header("Authorization") == "" {
+			resp.ReportUnauthorized()
+			return
+		}
+		resp.SetHeader("X-Filtered", "true")
+		chain(req, resp)
+	}))
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/private", nil))
+	tt.AssertEq(w.Code, http.StatusUnauthorized)
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/private", nil)
+	r.Header.Set("Authorization", "token")
+	h.ServeHTTP(w, r)
+	tt.AssertEq(w.Code, http.StatusOK)
+	tt.AssertEq(w.Header().Get("X-Filtered"), "true")
+	tt.AssertEq(w.Body.String(), "/private")
+}
+
+func TestRouteMeta(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	s.AddFuncFilter("/", func(req Request, resp Response, chain FilterChain) {
+		if scope, _ := req.Meta("scope").(string); scope != "" && req.Header("Scope") != scope {
+			resp.ReportForbidden()
+			return
+		}
+		resp.SetHeader("X-Pattern", req.Pattern())
+		chain(req, resp)
+	})
+	s.Get("/users/:id", EmptyHandlerFunc)
+	s.Get("/public", EmptyHandlerFunc)
+	tt.AssertNil(s.SetMeta("/users/:id", "scope", "user:read"))
+	tt.AssertNil(s.SetMeta("/users/:id", "tier", 2))
+	tt.AssertEq(s.SetMeta("/users/:uid", "scope", "user:write"), ErrRouteNotFound)
+	tt.AssertEq(s.SetMeta("/users", "scope", "user:write"), ErrRouteNotFound)
+
+	serve := func(path, scope string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Scope", scope)
+		s.ServeHTTP(w, r)
+		return w
+	}
+	tt.AssertEq(serve("/users/1", "").Code, http.StatusForbidden)
+	w := serve("/users/1", "user:read")
+	tt.AssertEq(w.Code, http.StatusOK)
+	tt.AssertEq(w.Header().Get("X-Pattern"), "/users/:id")
+	tt.AssertEq(serve("/public", "").Header().Get("X-Pattern"), "/public")
+	tt.AssertEq(serve("/none", "").Header().Get("X-Pattern"), "")
+
+	routes := s.Routes()
+	tt.AssertEq(routes[2].Pattern, "/users/:id")
+	tt.AssertEq(routes[2].Meta, map[string]interface{}{"scope": "user:read", "tier": 2})
+}
+
+func TestForm(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	s.FormMemory, s.FormMaxSize = 16, 1024
+	var tmpFile string
+	s.Post("/upload", func(req Request, resp Response) {
+		if err := req.ParseForm(); err != nil {
+			resp.ReportRequestEntityTooLarge()
+			return
+		}
+		f, fh, err := req.FormFile("file")
+		tt.AssertNil(err)
+		defer f.Close()
+		if osf, is := f.(*os.File); is {
+			tmpFile = osf.Name()
+		}
+		data, _ := ioutil.ReadAll(f)
+		resp.Write([]byte(req.FormValue("name") + " " + fh.Filename + " " + string(data)))
+		_, _, err = req.FormFile("none")
+		tt.AssertEq(err, ErrNoFile)
+	})
+	s.Post("/form", func(req Request, resp Response) {
+		resp.Write([]byte(strings.Join(req.FormValues("tag"), ",") + " " + req.FormValue("q")))
+	})
+
+	uploadBody := func(size int) (*bytes.Buffer, string) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("name", "zerver")
+		fw, _ := mw.CreateFormFile("file", "a.txt")
+		fw.Write([]byte(strings.Repeat("x", size)))
+		mw.Close()
+		return &body, mw.FormDataContentType()
+	}
+	upload := func(size int) *httptest.ResponseRecorder {
+		body, typ := uploadBody(size)
+		r := httptest.NewRequest("POST", "/upload", body)
+		r.Header.Set(HEADER_CONTENTTYPE, typ)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+	w := upload(100)
+	tt.AssertEq(w.Body.String(), "zerver a.txt "+strings.Repeat("x", 100))
+	tt.AssertTrue(tmpFile != "")
+	_, err := os.Stat(tmpFile)
+	tt.AssertTrue(os.IsNotExist(err))
+	tt.AssertEq(upload(2048).Code, http.StatusRequestEntityTooLarge)
+
+	// connection is closed for the rest of body is not read
+	ts := httptest.NewServer(s)
+	body, typ := uploadBody(2048)
+	resp, err := http.Post(ts.URL+"/upload", typ, body)
+	tt.AssertNil(err)
+	resp.Body.Close()
+	ts.Close()
+	tt.AssertEq(resp.StatusCode, http.StatusRequestEntityTooLarge)
+	tt.AssertTrue(resp.Close)
+
+	var r *http.Request
+
+	r = httptest.NewRequest("POST", "/form?q=query", strings.NewReader("tag=a&tag=b&q=body"))
+	r.Header.Set(HEADER_CONTENTTYPE, "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	tt.AssertEq(w.Body.String(), "a,b body")
+}
+
+type bindUser struct {
+	ID     int      `path:"id"`
+	Page   int      `query:"page" validate:"min=1"`
+	Tags   []string `query:"tag"`
+	Tenant string   `header:"X-Tenant" validate:"required"`
+	Name   string   `json:"name" form:"name" validate:"required,max=5"`
+	Role   string   `json:"role" form:"role" validate:"enum=admin|user"`
+	Email  string   `json:"email" validate:"regexp=^[a-z]+@[a-z]+\\.com$"`
+}
+
+func TestBind(t *testing.T) {
+	tt := test.WrapTest(t)
+	s := NewServer()
+	s.ContentType = CONTENTTYPE_JSON
+	var u bindUser
+	s.Post("/users/:id", HandleError(func(req Request, resp Response) error {
+		u = bindUser{}
+		return req.Bind(&u)
+	}))
+	bind := func(path, contentType, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		r.Header.Set("X-Tenant", "acme")
+		if contentType != "" {
+			r.Header.Set(HEADER_CONTENTTYPE, contentType)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	w := bind("/users/12?page=2&tag=a&tag=b", CONTENTTYPE_JSON, `{"name":"bob","role":"admin","email":"bob@x.com"}`)
+	tt.AssertEq(w.Code, http.StatusOK)
+	tt.AssertEq(u.ID, 12)
+	tt.AssertEq(u.Page, 2)
+	tt.AssertEq(strings.Join(u.Tags, ","), "a,b")
+	tt.AssertEq(u.Tenant, "acme")
+	tt.AssertEq(u.Name, "bob")
+
+	w = bind("/users/12", "application/x-www-form-urlencoded", "name=alice&role=user")
+	tt.AssertEq(w.Code, http.StatusOK)
+	tt.AssertEq(u.Name, "alice")
+	tt.AssertEq(u.Role, "user")
+
+	w = bind("/users/abc", "", "")
+	tt.AssertEq(w.Code, http.StatusBadRequest)
+	tt.AssertEq(strings.TrimSpace(w.Body.String()),
+		`{"message":"Bad Request","fields":[{"field":"id","rule":"type","message":"invalid value \"abc\""}]}`)
+
+	w = bind("/users/12", CONTENTTYPE_JSON, `{"name":`)
+	tt.AssertEq(w.Code, http.StatusBadRequest)
+	w = bind("/users/12", "text/csv", "a,b")
+	tt.AssertEq(w.Code, http.StatusUnsupportedMediaType)
+
+	w = bind("/users/12?page=-1", CONTENTTYPE_JSON, `{"name":"bobbie","role":"root","email":"bob"}`)
+	tt.AssertEq(w.Code, http.StatusUnprocessableEntity)
+	var he HTTPError
+	tt.AssertNil(json.Unmarshal(w.Body.Bytes(), &he))
+	var fields []string
+	for _, f := range he.Fields {
+		fields = append(fields, f.Field+":"+f.Rule)
+	}
+	tt.AssertEq(strings.Join(fields, ","), "page:min,name:max,role:enum,email:regexp")
+
+	// supplied zero values are validated, absent optional fields are not
+	w = bind("/users/12?page=0", CONTENTTYPE_JSON, `{"name":"bob","role":""}`)
+	tt.AssertEq(w.Code, http.StatusUnprocessableEntity)
+	he = HTTPError{}
+	tt.AssertNil(json.Unmarshal(w.Body.Bytes(), &he))
+	fields = fields[:0]
+	for _, f := range he.Fields {
+		fields = append(fields, f.Field+":"+f.Rule)
+	}
+	tt.AssertEq(strings.Join(fields, ","), "page:min,role:enum")
+	w = bind("/users/12", CONTENTTYPE_XML, `<user><Name>bob</Name><Role></Role></user>`)
+	tt.AssertEq(w.Code, http.StatusUnprocessableEntity)
+	tt.AssertTrue(strings.Contains(w.Body.String(), `"field":"role","rule":"enum"`))
+	w = bind("/users/12", CONTENTTYPE_XML, `<user><Name>bob</Name></user>`)
+	tt.AssertEq(w.Code, http.StatusOK)
+
+	w = bind("/users/12", CONTENTTYPE_JSON, `{}`)
+	tt.AssertEq(w.Code, http.StatusUnprocessableEntity)
+	tt.AssertTrue(strings.Contains(w.Body.String(), `"field":"name","rule":"required"`))
+
+	s.FormMaxSize = 16
+	w = bind("/users/12", CONTENTTYPE_JSON, `{"name":"bob","role":"admin"}`)
+	tt.AssertEq(w.Code, http.StatusRequestEntityTooLarge)
+}
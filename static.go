@@ -0,0 +1,275 @@
+package zerver
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StaticOption control the behaviour of static file serving
+type StaticOption uint8
+
+const (
+	// StaticListDir list files of directory which has no index.html
+	StaticListDir StaticOption = 1 << iota
+	// StaticSPA serve index.html of root for paths not exist, it's useful
+	// for single page application which do routing at client side
+	StaticSPA
+
+	StaticNone StaticOption = 0
+)
+
+const (
+	_STATIC_INDEX = "index.html"
+	_STATIC_VAR   = "subpath"
+	_GZIP_SUFFIX  = ".gz"
+)
+
+type (
+	// staticHandler serve files from a file system, Range and conditional
+	// requests are processed by http.ServeContent
+	staticHandler struct {
+		EmptyHandler
+		root   fs.FS
+		option StaticOption
+		// etags of files which has no modify time, such as files of embed.FS,
+		// it's shared by handlers of prefix and sub paths
+		etags *sync.Map
+	}
+)
+
+// Static serve files under root for prefix and all sub paths of it, the sub
+// path is captured by catch-all variable "subpath". If client accept gzip and
+// there is a ".gz" file beside the requested file, it's served instead.
+func (rt *router) Static(prefix string, root fs.FS, option StaticOption) error {
+	base := strings.TrimSuffix(prefix, "/")
+	etags := new(sync.Map)
+	err := rt.AddHandler(mountPattern(prefix), &staticHandler{root: root, option: option, etags: etags})
+	if err == nil {
+		err = rt.AddHandler(base+"/*"+_STATIC_VAR, &staticHandler{root: root, option: option, etags: etags})
+	}
+	return err
+}
+
+func (*staticHandler) serveRemains() {}
+
+// Handler implements MethodIndicator, only GET is served, HEAD is served by it
+func (sh *staticHandler) Handler(method string) HandlerFunc {
+	if method == GET {
+		return sh.serve
+	}
+	return nil
+}
+
+func (sh *staticHandler) serve(req Request, resp Response) {
+	resp.RemoveHeader(HEADER_CONTENTTYPE)
+	name, urlPath := req.URLVar(_STATIC_VAR), req.URL().Path
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		name = "."
+	}
+	info, err := fs.Stat(sh.root, name)
+	if err != nil {
+		if sh.option&StaticSPA != 0 {
+			sh.serveFile(req, resp, _STATIC_INDEX)
+		} else {
+			resp.ReportNotFound()
+		}
+		return
+	}
+	// redirect like http.FileServer, so relative links are resolved correctly
+	isDir, slash := info.IsDir(), strings.HasSuffix(urlPath, "/")
+	if isDir != slash {
+		if isDir {
+			sh.redirect(req, resp, urlPath+"/")
+		} else {
+			sh.redirect(req, resp, strings.TrimSuffix(urlPath, "/"))
+		}
+		return
+	}
+	if !isDir {
+		sh.serveFile(req, resp, name)
+		return
+	}
+	index := path.Join(name, _STATIC_INDEX)
+	if _, err = fs.Stat(sh.root, index); err == nil {
+		sh.serveFile(req, resp, index)
+	} else if sh.option&StaticListDir != 0 {
+		sh.listDir(resp, name)
+	} else {
+		resp.ReportNotFound()
+	}
+}
+
+func (sh *staticHandler) redirect(req Request, resp Response, p string) {
+	u := url.URL{Path: p, RawQuery: req.URL().RawQuery}
+	resp.SetHeader(HEADER_LOCATION, u.String())
+	resp.ReportMovedPermanently()
+}
+
+// serveFile serve a regular file, the precompressed one is preferred
+func (sh *staticHandler) serveFile(req Request, resp Response, name string) {
+	resp.AddHeader(HEADER_VARY, HEADER_ACCEPTENCODING)
+	if acceptGzip(req.AcceptEncodings()) {
+		if f, info, err := sh.open(name + _GZIP_SUFFIX); err == nil {
+			defer f.Close()
+			resp.SetContentEncoding(ENCODING_GZIP)
+			sh.serveContent(req, resp, name, f, info, "-gz")
+			return
+		}
+	}
+	f, info, err := sh.open(name)
+	if err != nil {
+		resp.ReportNotFound()
+		return
+	}
+	defer f.Close()
+	sh.serveContent(req, resp, name, f, info, "")
+}
+
+// acceptGzip check whether gzip is acceptable by Accept-Encoding header, coding
+// with q=0 is not acceptable, "*" match gzip if it's not listed
+func acceptGzip(header string) bool {
+	accept, star := false, false
+	for _, coding := range strings.Split(header, ",") {
+		q := 1.0
+		if i := strings.IndexByte(coding, ';'); i >= 0 {
+			param := strings.TrimSpace(coding[i+1:])
+			if strings.HasPrefix(param, "q=") || strings.HasPrefix(param, "Q=") {
+				var err error
+				if q, err = strconv.ParseFloat(param[2:], 64); err != nil {
+					q = 0
+				}
+			}
+			coding = coding[:i]
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case ENCODING_GZIP:
+			return q > 0
+		case "*":
+			star = true
+			accept = q > 0
+		}
+	}
+	return star && accept
+}
+
+// open open a regular file
+func (sh *staticHandler) open(name string) (fs.File, fs.FileInfo, error) {
+	f, err := sh.root.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err == nil && !info.Mode().IsRegular() {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+// serveContent set ETag and serve file by http.ServeContent, name is used to
+// detect content type, suffix is appended to etag to distinguish variants, it's
+// only non-empty for compressed file
+func (sh *staticHandler) serveContent(req Request, resp Response, name string,
+	f fs.File, info fs.FileInfo, suffix string) {
+	content, is := f.(io.ReadSeeker)
+	if !is {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			resp.ReportInternalServerError()
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	etag, err := sh.etag(name+suffix, info, content)
+	if err != nil {
+		resp.ReportInternalServerError()
+		return
+	}
+	if suffix != "" { // content of compressed file can't be used to detect content type
+		ctype := mime.TypeByExtension(path.Ext(name))
+		if ctype == "" {
+			if ctype, err = sh.sniff(name); err != nil {
+				resp.ReportInternalServerError()
+				return
+			}
+		}
+		resp.SetContentType(ctype)
+	}
+	resp.SetHeader(HEADER_ETAG, etag)
+	http.ServeContent(responseWriter{resp}, req.Raw(), name, info.ModTime(), content)
+}
+
+// sniff detect content type by content of the uncompressed file
+func (sh *staticHandler) sniff(name string) (string, error) {
+	f, _, err := sh.open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var buf [512]byte
+	n, err := io.ReadFull(f, buf[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// etag generate etag from modify time and size, if modify time is unknown,
+// use checksum of content instead, it's computed only once
+func (sh *staticHandler) etag(key string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	modTime := info.ModTime()
+	if !modTime.IsZero() && !modTime.Equal(time.Unix(0, 0)) {
+		return fmt.Sprintf(`"%x-%x"`, modTime.UnixNano(), info.Size()), nil
+	}
+	if etag, has := sh.etags.Load(key); has {
+		return etag.(string), nil
+	}
+	hash := crc32.NewIEEE()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := fmt.Sprintf(`"%x-%x"`, hash.Sum32(), info.Size())
+	sh.etags.Store(key, etag)
+	return etag, nil
+}
+
+// listDir write a simple html page list all files of directory
+func (sh *staticHandler) listDir(resp Response, name string) {
+	entries, err := fs.ReadDir(sh.root, name)
+	if err != nil {
+		resp.ReportInternalServerError()
+		return
+	}
+	resp.SetContentType(CONTENTTYPE_HTML + "; charset=utf-8")
+	var buf bytes.Buffer
+	buf.WriteString("<pre>\n")
+	for _, e := range entries {
+		n := e.Name()
+		if e.IsDir() {
+			n += "/"
+		}
+		u := url.URL{Path: n}
+		fmt.Fprintf(&buf, "<a href=\"%s\">%s</a>\n", html.EscapeString(u.String()), html.EscapeString(n))
+	}
+	buf.WriteString("</pre>\n")
+	resp.Write(buf.Bytes())
+}
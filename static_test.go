@@ -0,0 +1,100 @@
+package zerver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cosiner/golib/test"
+)
+
+func gzipData(s string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(s))
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestStatic(t *testing.T) {
+	tt := test.WrapTest(t)
+	root := fstest.MapFS{
+		"index.html":     {Data: []byte("home")},
+		"app.js":         {Data: []byte("console.log(1)")},
+		"app.js.gz":      {Data: []byte("gzipped")},
+		"LICENSE":        {Data: []byte("MIT License")},
+		"LICENSE.gz":     {Data: gzipData("MIT License")},
+		"docs/a.txt":     {Data: []byte("abcdef")},
+		"docs/b c.txt":   {Data: []byte("b")},
+		"docs/sub/x.txt": {Data: []byte("x")},
+	}
+	s := NewServer()
+	tt.AssertNil(s.Static("/static/", root, StaticListDir))
+	tt.AssertNil(s.Static("/spa", root, StaticSPA))
+
+	serve := func(method, path string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(GET, "/static/docs/a.txt")
+	tt.AssertEq(w.Code, http.StatusOK)
+	tt.AssertEq(w.Body.String(), "abcdef")
+	tt.AssertEq(w.Header().Get(HEADER_CONTENTTYPE), "text/plain; charset=utf-8")
+	etag := w.Header().Get(HEADER_ETAG)
+	tt.AssertTrue(etag != "")
+
+	w = serve(GET, "/static/docs/a.txt", "If-None-Match", etag)
+	tt.AssertEq(w.Code, http.StatusNotModified)
+	w = serve(GET, "/static/docs/a.txt", "Range", "bytes=1-2")
+	tt.AssertEq(w.Code, http.StatusPartialContent)
+	tt.AssertEq(w.Body.String(), "bc")
+	w = serve(HEAD, "/static/docs/a.txt")
+	tt.AssertEq(w.Code, http.StatusOK)
+	tt.AssertEq(w.Body.Len(), 0)
+	w = serve(POST, "/static/docs/a.txt")
+	tt.AssertEq(w.Code, http.StatusMethodNotAllowed)
+
+	w = serve(GET, "/static/app.js", HEADER_ACCEPTENCODING, "gzip, deflate")
+	tt.AssertEq(w.Body.String(), "gzipped")
+	tt.AssertEq(w.Header().Get(HEADER_CONTENTENCODING), ENCODING_GZIP)
+	tt.AssertEq(w.Header().Get(HEADER_CONTENTTYPE), "text/javascript; charset=utf-8")
+	tt.AssertTrue(w.Header().Get(HEADER_ETAG) != serve(GET, "/static/app.js").Header().Get(HEADER_ETAG))
+	for _, accept := range []string{"gzip;q=0, deflate", "deflate, *", "identity"} {
+		w = serve(GET, "/static/app.js", HEADER_ACCEPTENCODING, accept)
+		tt.AssertEq(w.Body.String() == "gzipped", accept == "deflate, *", accept)
+	}
+	w = serve(GET, "/static/app.js", HEADER_ACCEPTENCODING, "*;q=0, GZIP;q=0.5")
+	tt.AssertEq(w.Body.String(), "gzipped")
+
+	w = serve(GET, "/static/LICENSE", HEADER_ACCEPTENCODING, "gzip")
+	tt.AssertEq(w.Header().Get(HEADER_CONTENTENCODING), ENCODING_GZIP)
+	tt.AssertEq(w.Header().Get(HEADER_CONTENTTYPE), "text/plain; charset=utf-8")
+	tt.AssertEq(w.Body.Bytes(), root["LICENSE.gz"].Data)
+
+	w = serve(GET, "/static")
+	tt.AssertEq(w.Code, http.StatusMovedPermanently)
+	tt.AssertEq(w.Header().Get(HEADER_LOCATION), "/static/")
+	w = serve(GET, "/static/")
+	tt.AssertEq(w.Body.String(), "home")
+	w = serve(GET, "/static/docs/")
+	tt.AssertEq(w.Body.String(), "<pre>\n<a href=\"a.txt\">a.txt</a>\n<a href=\"b%20c.txt\">b c.txt</a>\n<a href=\"sub/\">sub/</a>\n</pre>\n")
+	w = serve(GET, "/static/none")
+	tt.AssertEq(w.Code, http.StatusNotFound)
+	w = serve(GET, "/static/../../etc/passwd")
+	tt.AssertEq(w.Code, http.StatusNotFound)
+
+	w = serve(GET, "/spa/users/1")
+	tt.AssertEq(w.Code, http.StatusOK)
+	tt.AssertEq(w.Body.String(), "home")
+	w = serve(GET, "/spa/docs/")
+	tt.AssertEq(w.Code, http.StatusNotFound)
+}
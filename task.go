@@ -1,10 +1,20 @@
 package zerver
 
+import (
+	"context"
+	"net/http"
+)
+
 type (
 	// Task
 	Task interface {
 		URLVarIndexer
 		Value() interface{}
+		// Context return context of task, it's the context passed to
+		// StartTaskContext
+		Context() context.Context
+		// WithContext replace context of task
+		WithContext(ctx context.Context)
 		serverGetter
 		destroy()
 	}
@@ -17,18 +27,26 @@ type (
 		Handle(Task)
 	}
 
+	// taskResponseWriter is the response writer for filters of task, all writes
+	// are discarded
+	taskResponseWriter struct {
+		header http.Header
+	}
+
 	task struct {
 		serverGetter
 		URLVarIndexer
 		value interface{}
+		ctx   context.Context
 	}
 )
 
-func newTask(s serverGetter, indexer URLVarIndexer, value interface{}) Task {
+func newTask(s serverGetter, ctx context.Context, indexer URLVarIndexer, value interface{}) Task {
 	return &task{
 		serverGetter:  s,
 		URLVarIndexer: indexer,
 		value:         value,
+		ctx:           ctx,
 	}
 }
 
@@ -40,6 +58,25 @@ func (t *task) Value() interface{} {
 	return t.value
 }
 
+func (t *task) Context() context.Context {
+	return t.ctx
+}
+
+func (t *task) WithContext(ctx context.Context) {
+	if ctx == nil {
+		panic("nil context")
+	}
+	t.ctx = ctx
+}
+
 func (TaskHandlerFunc) Init(*Server) error  { return nil }
 func (fn TaskHandlerFunc) Handle(task Task) { fn(task) }
 func (TaskHandlerFunc) Destroy()            {}
+
+func newTaskResponseWriter() taskResponseWriter {
+	return taskResponseWriter{header: make(http.Header)}
+}
+
+func (w taskResponseWriter) Header() http.Header            { return w.header }
+func (w taskResponseWriter) Write(data []byte) (int, error) { return len(data), nil }
+func (taskResponseWriter) WriteHeader(int)                  {}
@@ -0,0 +1,106 @@
+package zerver
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	. "github.com/cosiner/golib/errors"
+)
+
+// timeoutWriter buffer response of route which has timeout, after timeout,
+// all writes to it will be discarded, so the slow handler will never touch the
+// real response writer. Writes after context done are also treated as timeout,
+// even the handler finished before it's noticed
+type timeoutWriter struct {
+	sync.Mutex
+	ctx      context.Context
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+	finished bool
+}
+
+const (
+	ErrHandlerTimeout = Err("Handler timeout")
+)
+
+// routeTimeout return the timeout of matched route
+func routeTimeout(indexer URLVarIndexer) time.Duration {
+	return indexer.varIndexer().timeout
+}
+
+func newTimeoutWriter(ctx context.Context) *timeoutWriter {
+	return &timeoutWriter{
+		ctx:    ctx,
+		header: make(http.Header),
+	}
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.Lock()
+	if !tw.expired() && tw.status == 0 {
+		tw.status = status
+	}
+	tw.Unlock()
+}
+
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.Lock()
+	defer tw.Unlock()
+	if tw.expired() {
+		return 0, ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(data)
+}
+
+// finish mark handler finished, then it can't be timeout
+func (tw *timeoutWriter) finish() {
+	tw.Lock()
+	tw.finished = true
+	tw.Unlock()
+}
+
+// expired check whether writer is timeout or context is done, the lock must
+// be held
+func (tw *timeoutWriter) expired() bool {
+	if !tw.timedOut && tw.ctx.Err() != nil {
+		tw.timedOut = true
+	}
+	return tw.timedOut
+}
+
+// timeout mark writer timeout, if handler has finished without writes after
+// context done, false is returned
+func (tw *timeoutWriter) timeout() bool {
+	tw.Lock()
+	defer tw.Unlock()
+	if tw.finished && !tw.timedOut {
+		return false
+	}
+	tw.timedOut = true
+	return true
+}
+
+// writeTo write buffered header, status and body to real response writer
+func (tw *timeoutWriter) writeTo(w http.ResponseWriter) {
+	header := w.Header()
+	for k, v := range tw.header {
+		header[k] = v
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	w.WriteHeader(tw.status)
+	w.Write(tw.buf.Bytes())
+}
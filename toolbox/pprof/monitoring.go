@@ -5,6 +5,7 @@
 package pprof
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/url"
 	"runtime"
@@ -120,9 +121,14 @@ func initRoutes() bool {
 		pprof.WriteHeapProfile(resp)
 	}
 
-	infos["/routes"] = "Get all routes"
+	infos["/routes"] = "Get all routes, use ?format=json to get route list as json"
 	routes["/routes"] = func(req zerver.Request, resp zerver.Response) {
-		req.Server().PrintRouteTree(resp)
+		if req.Param("format") == "json" {
+			resp.SetContentType(zerver.CONTENTTYPE_JSON)
+			json.NewEncoder(resp).Encode(req.Server().Routes())
+		} else {
+			req.Server().PrintRouteTree(resp)
+		}
 	}
 
 	infos["/statistic"] = "Get server statistic info such as uptime"
@@ -0,0 +1,277 @@
+// Package proxy provide a reverse proxy handler for zerver, it forward requests
+// to upstreams with load balancing and passive health checking, websocket
+// upgrades are tunneled to upstream.
+//
+// The handler should be registered on pattern end with catch-all variable
+// "subpath", such as "/legacy/*subpath", the value is appended to the path of
+// upstream url, unless Config.KeepPath is set.
+//
+// Because requests of websocket handlers are not served as normal request,
+// the pattern of proxy should not have a websocket handler to tunnel upgrades.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cosiner/zerver"
+
+	. "github.com/cosiner/golib/errors"
+)
+
+type (
+	// Balance is the strategy to choose upstream
+	Balance uint8
+
+	// Config is the configuration of proxy, only Upstreams is required
+	Config struct {
+		// Upstreams is the urls of upstreams, such as "http://127.0.0.1:8080/api"
+		Upstreams []string
+		Balance   Balance
+		// PathVar is the variable name of sub path, default is "subpath"
+		PathVar string
+		// KeepPath forward the whole request path instead of the sub path
+		KeepPath bool
+		// PreserveHost send the Host header of request to upstream, default
+		// is the host of upstream
+		PreserveHost bool
+		// Header will be set to the request forwarded to upstream
+		Header http.Header
+
+		// DialTimeout is the timeout of connecting to upstream
+		DialTimeout time.Duration
+		// ResponseHeaderTimeout is the timeout of waiting response header after
+		// request was sent
+		ResponseHeaderTimeout time.Duration
+
+		// MaxFails is the count of continuous failures to mark upstream down,
+		// default 1
+		MaxFails int
+		// FailTimeout is the duration upstream is down, default 10 seconds
+		FailTimeout time.Duration
+
+		// Transport is used to send request to upstream, if it's set, the
+		// timeouts above are ignored
+		Transport http.RoundTripper
+	}
+
+	// Proxy is a reverse proxy handler
+	Proxy struct {
+		zerver.EmptyHandler
+		conf      Config
+		upstreams []*upstream
+		next      uint32
+		proxy     *httputil.ReverseProxy
+	}
+
+	upstream struct {
+		url       *url.URL
+		active    int64 // active requests
+		fails     int32 // continuous failures
+		downUntil int64 // unix nano
+	}
+
+	// target is the upstream and path choosed for a request
+	target struct {
+		upstream *upstream
+		path     string
+	}
+
+	targetKey struct{}
+)
+
+const (
+	// RoundRobin choose upstreams in turn
+	RoundRobin Balance = iota
+	// LeastConn choose the upstream with least active requests
+	LeastConn
+)
+
+const (
+	HEADER_FORWARDED_HOST  = "X-Forwarded-Host"
+	HEADER_FORWARDED_PROTO = "X-Forwarded-Proto"
+
+	ErrNoUpstream = Err("no upstream for proxy")
+)
+
+// New create a reverse proxy handler
+func New(conf Config) (*Proxy, error) {
+	if len(conf.Upstreams) == 0 {
+		return nil, ErrNoUpstream
+	}
+	if conf.PathVar == "" {
+		conf.PathVar = "subpath"
+	}
+	if conf.MaxFails <= 0 {
+		conf.MaxFails = 1
+	}
+	if conf.FailTimeout <= 0 {
+		conf.FailTimeout = 10 * time.Second
+	}
+	p := &Proxy{conf: conf}
+	for _, u := range conf.Upstreams {
+		pu, err := url.Parse(u)
+		if err != nil {
+			return nil, err
+		}
+		if pu.Scheme == "" || pu.Host == "" {
+			return nil, Errorf("invalid upstream url %s: scheme and host are required", u)
+		}
+		p.upstreams = append(p.upstreams, &upstream{url: pu})
+	}
+	transport := conf.Transport
+	if transport == nil {
+		transport = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   conf.DialTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ResponseHeaderTimeout: conf.ResponseHeaderTimeout,
+			MaxIdleConnsPerHost:   32,
+			IdleConnTimeout:       90 * time.Second,
+		}
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Director:       p.direct,
+		Transport:      transport,
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   p.handleError,
+	}
+	return p, nil
+}
+
+// Handler implements zerver.MethodIndicator, all methods are forwarded
+func (p *Proxy) Handler(string) zerver.HandlerFunc {
+	return p.serve
+}
+
+func (p *Proxy) serve(req zerver.Request, resp zerver.Response) {
+	u := p.pick()
+	atomic.AddInt64(&u.active, 1)
+	defer atomic.AddInt64(&u.active, -1)
+
+	// let upstream decide content type
+	resp.RemoveHeader(zerver.HEADER_CONTENTTYPE)
+	r := req.Raw()
+	t := target{upstream: u, path: r.URL.Path}
+	if !p.conf.KeepPath {
+		t.path = "/" + req.URLVar(p.conf.PathVar)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), targetKey{}, t))
+	p.proxy.ServeHTTP(zerver.ResponseWriter(resp), r)
+}
+
+// pick choose an available upstream, if all upstreams are down, the next one
+// is used anyway
+func (p *Proxy) pick() *upstream {
+	var (
+		ups   = p.upstreams
+		n     = len(ups)
+		start = int(atomic.AddUint32(&p.next, 1)-1) % n
+		now   = time.Now().UnixNano()
+		best  *upstream
+	)
+	for i := 0; i < n; i++ {
+		u := ups[(start+i)%n]
+		if !u.available(now) {
+			continue
+		}
+		if p.conf.Balance == RoundRobin {
+			return u
+		}
+		if best == nil || atomic.LoadInt64(&u.active) < atomic.LoadInt64(&best.active) {
+			best = u
+		}
+	}
+	if best == nil {
+		best = ups[start]
+	}
+	return best
+}
+
+// direct rewrite request to upstream
+func (p *Proxy) direct(r *http.Request) {
+	t := r.Context().Value(targetKey{}).(target)
+	u := t.upstream.url
+	r.URL.Scheme, r.URL.Host = u.Scheme, u.Host
+	r.URL.Path, r.URL.RawPath = joinPath(u.Path, t.path), ""
+	if u.RawQuery != "" {
+		if r.URL.RawQuery == "" {
+			r.URL.RawQuery = u.RawQuery
+		} else {
+			r.URL.RawQuery = u.RawQuery + "&" + r.URL.RawQuery
+		}
+	}
+
+	r.Header.Set(HEADER_FORWARDED_HOST, r.Host)
+	if r.TLS != nil {
+		r.Header.Set(HEADER_FORWARDED_PROTO, "https")
+	} else {
+		r.Header.Set(HEADER_FORWARDED_PROTO, "http")
+	}
+	if !p.conf.PreserveHost {
+		r.Host = ""
+	}
+	for name, values := range p.conf.Header {
+		r.Header[name] = values
+	}
+}
+
+func (p *Proxy) modifyResponse(resp *http.Response) error {
+	if t, is := resp.Request.Context().Value(targetKey{}).(target); is {
+		t.upstream.succeed()
+	}
+	return nil
+}
+
+// handleError mark upstream failed, report 504 for timeout, otherwise 502
+func (p *Proxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) { // client gone
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	if t, is := r.Context().Value(targetKey{}).(target); is {
+		t.upstream.fail(p.conf.MaxFails, p.conf.FailTimeout)
+	}
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &ne) && ne.Timeout() {
+		w.WriteHeader(http.StatusGatewayTimeout)
+	} else {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+}
+
+func (u *upstream) available(now int64) bool {
+	return atomic.LoadInt64(&u.downUntil) <= now
+}
+
+func (u *upstream) succeed() {
+	atomic.StoreInt32(&u.fails, 0)
+}
+
+// fail record a failure, if continuous failures reach maxFails, the upstream
+// is marked down for failTimeout
+func (u *upstream) fail(maxFails int, failTimeout time.Duration) {
+	if atomic.AddInt32(&u.fails, 1) >= int32(maxFails) {
+		atomic.StoreInt32(&u.fails, 0)
+		atomic.StoreInt64(&u.downUntil, time.Now().Add(failTimeout).UnixNano())
+	}
+}
+
+func joinPath(a, b string) string {
+	switch aslash, bslash := strings.HasSuffix(a, "/"), strings.HasPrefix(b, "/"); {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
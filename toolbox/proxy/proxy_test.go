@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cosiner/golib/test"
+	"github.com/cosiner/zerver"
+)
+
+func upstreamServer(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") == "websocket" {
+			conn, brw, _ := w.(http.Hijacker).Hijack()
+			defer conn.Close()
+			brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+			brw.Flush()
+			line, _ := brw.ReadString('\n')
+			brw.WriteString(name + ":" + line)
+			brw.Flush()
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(name + " " + r.URL.RequestURI() + " " +
+			r.Header.Get(HEADER_FORWARDED_HOST) + " " + r.Header.Get("X-Forwarded-For")))
+	}))
+}
+
+func get(url string) string {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err.Error()
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestProxy(t *testing.T) {
+	tt := test.WrapTest(t)
+	up1, up2 := upstreamServer("up1"), upstreamServer("up2")
+	defer up1.Close()
+	defer up2.Close()
+	down := httptest.NewServer(nil)
+	down.Close()
+
+	p, err := New(Config{Upstreams: []string{up1.URL + "/api?v=1", up2.URL, down.URL}})
+	tt.AssertNil(err)
+	s := zerver.NewServer()
+	tt.AssertNil(s.AddHandler("/legacy/*subpath", p))
+	front := httptest.NewServer(s)
+	defer front.Close()
+
+	host := strings.TrimPrefix(front.URL, "http://")
+	tt.AssertEq(get(front.URL+"/legacy/users?id=1"), "up1 /api/users?v=1&id=1 "+host+" 127.0.0.1")
+	tt.AssertTrue(strings.HasPrefix(get(front.URL+"/legacy/users"), "up2 /users "))
+	resp, err := http.Get(front.URL + "/legacy/users")
+	tt.AssertNil(err)
+	resp.Body.Close()
+	tt.AssertEq(resp.StatusCode, http.StatusBadGateway)
+	// down upstream is skipped
+	for i := 0; i < 4; i++ {
+		tt.AssertTrue(strings.HasPrefix(get(front.URL+"/legacy/users"), "up"))
+	}
+
+	conn, err := net.Dial("tcp", host)
+	tt.AssertNil(err)
+	defer conn.Close()
+	conn.Write([]byte("GET /legacy/ws HTTP/1.1\r\nHost: " + host +
+		"\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"))
+	br := bufio.NewReader(conn)
+	wsResp, err := http.ReadResponse(br, nil)
+	tt.AssertNil(err)
+	tt.AssertEq(wsResp.StatusCode, http.StatusSwitchingProtocols)
+	conn.Write([]byte("hello\n"))
+	line, err := br.ReadString('\n')
+	tt.AssertNil(err)
+	tt.AssertTrue(strings.HasSuffix(line, ":hello\n"))
+}
+
+func TestLeastConn(t *testing.T) {
+	tt := test.WrapTest(t)
+	p, err := New(Config{Upstreams: []string{"http://a", "http://b"}, Balance: LeastConn})
+	tt.AssertNil(err)
+	p.upstreams[0].active = 2
+	for i := 0; i < 3; i++ {
+		tt.AssertEq(p.pick().url.Host, "b")
+	}
+	_, err = New(Config{Upstreams: []string{"/path"}})
+	tt.AssertTrue(err != nil)
+}
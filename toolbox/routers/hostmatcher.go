@@ -0,0 +1,154 @@
+package routers
+
+import (
+	"strings"
+
+	. "github.com/cosiner/golib/errors"
+)
+
+type (
+	// hostMatcher match host to the index of a host pattern, port of host is
+	// ignored. Host pattern is labels seperated by '.', each label can be:
+	//  static label, it's matched case-insensitive
+	//  :name, match one label
+	//  *name, match one or more labels, only allowed as the first label, name
+	//  is optional
+	// Static patterns are tried first, then patterns with ':' variables, the
+	// last is patterns start with '*', patterns of same kind are tried by order
+	// of added
+	hostMatcher struct {
+		patterns []hostPattern
+	}
+
+	hostPattern struct {
+		labels []string
+		kind   int
+		hasVar bool
+		index  int
+	}
+)
+
+const (
+	_HOST_STATIC = iota
+	_HOST_VARIABLE
+	_HOST_WILDCARD
+)
+
+// compileHost parse host pattern, port is removed
+func compileHost(pattern string, index int) (hostPattern, error) {
+	p := hostPattern{
+		labels: strings.Split(stripPort(pattern), "."),
+		index:  index,
+	}
+	for i, label := range p.labels {
+		switch {
+		case label == "":
+			return p, Errorf("Invalid host pattern %s: empty label", pattern)
+		case label[0] == '*':
+			if i != 0 {
+				return p, Errorf("Invalid host pattern %s: '*' must be the first label", pattern)
+			}
+			p.kind, p.hasVar = _HOST_WILDCARD, len(label) > 1
+		case label[0] == ':':
+			if len(label) == 1 {
+				return p, Errorf("Invalid host pattern %s: empty variable name", pattern)
+			}
+			if p.kind == _HOST_STATIC {
+				p.kind = _HOST_VARIABLE
+			}
+			p.hasVar = true
+		default:
+			p.labels[i] = strings.ToLower(label)
+		}
+	}
+	return p, nil
+}
+
+// add return a new matcher with the pattern added, index is the value
+// returned by match
+func (m hostMatcher) add(pattern string, index int) (hostMatcher, error) {
+	p, err := compileHost(pattern, index)
+	if err != nil {
+		return m, err
+	}
+	patterns := make([]hostPattern, 0, len(m.patterns)+1)
+	i := 0
+	for ; i < len(m.patterns) && m.patterns[i].kind <= p.kind; i++ {
+	}
+	patterns = append(patterns, m.patterns[:i]...)
+	patterns = append(patterns, p)
+	patterns = append(patterns, m.patterns[i:]...)
+	return hostMatcher{patterns: patterns}, nil
+}
+
+// match return index of the first matched pattern and host variables, if
+// not matched, -1 is returned
+func (m hostMatcher) match(host string) (int, map[string]string) {
+	host = stripPort(host)
+	for i := range m.patterns {
+		if vars, matched := m.patterns[i].match(host); matched {
+			return m.patterns[i].index, vars
+		}
+	}
+	return -1, nil
+}
+
+// match host from the last label to the first
+func (p *hostPattern) match(host string) (map[string]string, bool) {
+	var vars map[string]string
+	if p.hasVar {
+		vars = make(map[string]string)
+	}
+	end := len(host)
+	for i := len(p.labels) - 1; i >= 0; i-- {
+		if end < 0 { // host end, but pattern not
+			return nil, false
+		}
+		label := p.labels[i]
+		if label[0] == '*' {
+			if end == 0 {
+				return nil, false
+			}
+			if len(label) > 1 {
+				vars[label[1:]] = host[:end]
+			}
+			return vars, true
+		}
+		start := strings.LastIndexByte(host[:end], '.') + 1
+		value := host[start:end]
+		if value == "" {
+			return nil, false
+		}
+		if label[0] == ':' {
+			vars[label[1:]] = value
+		} else if !strings.EqualFold(label, value) {
+			return nil, false
+		}
+		end = start - 1
+	}
+	return vars, end < 0
+}
+
+// stripPort remove port and the trailing '.' of host, the ':' at the start of
+// label is variable of host pattern, not port
+func stripPort(host string) string {
+	if strings.HasPrefix(host, "[") { // ipv6
+		if end := strings.IndexByte(host, ']'); end > 0 {
+			return host[1:end]
+		}
+		return host
+	}
+	if i := strings.LastIndexByte(host, ':'); i > 0 && host[i-1] != '.' && isPort(host[i+1:]) {
+		host = host[:i]
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+func isPort(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
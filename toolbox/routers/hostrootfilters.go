@@ -6,45 +6,82 @@ import (
 	. "github.com/cosiner/zerver"
 )
 
+// HostRootFilters choose root filters by host pattern, see hostMatcher for
+// syntax of host pattern
 type HostRootFilters struct {
 	RootFilters
-	hosts   []string
-	filters []RootFilters
+	hosts    []string
+	filters  []RootFilters
+	matcher  hostMatcher
+	fallback RootFilters
 }
 
 // Implement RootFilters
 
-func (hr *HostRootFilters) AddRootFilters(host string, rfs RootFilters) {
+// AddRootFilters add root filters for host pattern
+func (hr *HostRootFilters) AddRootFilters(host string, rfs RootFilters) error {
+	matcher, err := hr.matcher.add(host, len(hr.filters))
+	if err != nil {
+		return err
+	}
 	l := len(hr.hosts) + 1
 	hosts, filters := make([]string, l), make([]RootFilters, l)
 	copy(hosts, hr.hosts)
 	copy(filters, hr.filters)
-	hosts[l], filters[l] = host, rfs
-	hr.hosts, hr.filters = hosts, filters
+	hosts[l-1], filters[l-1] = host, rfs
+	hr.hosts, hr.filters, hr.matcher = hosts, filters, matcher
+	return nil
+}
+
+// SetFallback set the root filters used when no host pattern is matched
+func (hr *HostRootFilters) SetFallback(rfs RootFilters) {
+	hr.fallback = rfs
 }
 
-func (hr *HostRootFilters) Init(s *Server) error {
+func (hr *HostRootFilters) iterate(fn func(RootFilters) bool) {
 	for _, f := range hr.filters {
-		if e := f.Init(s); e != nil {
-			return e
+		if !fn(f) {
+			return
 		}
 	}
-	return nil
+	if hr.fallback != nil {
+		fn(hr.fallback)
+	}
+}
+
+// Init init root filters of all hosts and fallback, if one of them failed,
+// destroy inited ones in reverse order
+func (hr *HostRootFilters) Init(s *Server) (err error) {
+	var inited []RootFilters
+	hr.iterate(func(f RootFilters) bool {
+		if err = f.Init(s); err != nil {
+			return false
+		}
+		inited = append(inited, f)
+		return true
+	})
+	if err != nil {
+		for i := len(inited) - 1; i >= 0; i-- {
+			inited[i].Destroy()
+		}
+	}
+	return
 }
 
 // Filters return all root filters
 func (hr *HostRootFilters) Filters(url *url.URL) []Filter {
-	host, hosts := url.Host, hr.hosts
-	for i := range hosts {
-		if hosts[i] == host {
-			return hr.filters[i].Filters(url)
-		}
+	if index, _ := hr.matcher.match(url.Host); index >= 0 {
+		return hr.filters[index].Filters(url)
+	}
+	if hr.fallback != nil {
+		return hr.fallback.Filters(url)
 	}
 	return nil
 }
 
 func (hr *HostRootFilters) Destroy() {
-	for _, f := range hr.filters {
+	hr.iterate(func(f RootFilters) bool {
 		f.Destroy()
-	}
+		return true
+	})
 }
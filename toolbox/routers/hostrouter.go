@@ -3,43 +3,72 @@ package routers
 import (
 	"io"
 	"net/url"
+	"reflect"
 
 	. "github.com/cosiner/zerver"
 
+	ref "github.com/cosiner/golib/reflect"
 	"github.com/cosiner/golib/sys"
 )
 
 type (
+	// HostRouter dispatch request to router by host, host pattern can contains
+	// variables, they can be accessed like url variables, see hostMatcher for
+	// syntax of host pattern
 	HostRouter struct {
 		Router
-		hosts   []string
-		routers []Router
+		hosts    []string
+		routers  []Router
+		matcher  hostMatcher
+		fallback Router
+	}
+
+	// hostVarIndexer add host variables to url variables, if there are same
+	// name variables in host and path, host's is used
+	hostVarIndexer struct {
+		URLVarIndexer
+		vars map[string]string
 	}
 )
 
+// emptyRouter is used when no router is matched and there is no fallback
+// router
+var emptyRouter = NewRouter()
+
 func NewHostRouter() *HostRouter {
 	return &HostRouter{}
 }
 
-func (hr *HostRouter) AddRouter(host string, rt Router) {
+// AddRouter add a router for host pattern
+func (hr *HostRouter) AddRouter(host string, rt Router) error {
+	matcher, err := hr.matcher.add(host, len(hr.routers))
+	if err != nil {
+		return err
+	}
 	l := len(hr.hosts) + 1
 	hosts, routers := make([]string, l), make([]Router, l)
 	copy(hosts, hr.hosts)
 	copy(routers, hr.routers)
-	hosts[l], routers[l] = host, rt
-	hr.hosts, hr.routers = hosts, routers
+	hosts[l-1], routers[l-1] = host, rt
+	hr.hosts, hr.routers, hr.matcher = hosts, routers, matcher
+	return nil
+}
+
+// SetFallback set the router used when no host pattern is matched
+func (hr *HostRouter) SetFallback(rt Router) {
+	hr.fallback = rt
 }
 
 // Implement RouterMatcher
 
-func (hr *HostRouter) match(url *url.URL) Router {
-	host, hosts := url.Host, hr.hosts
-	for i := range hosts {
-		if hosts[i] == host {
-			return hr.routers[i]
-		}
+func (hr *HostRouter) match(url *url.URL) (Router, map[string]string) {
+	if index, vars := hr.matcher.match(url.Host); index >= 0 {
+		return hr.routers[index], vars
 	}
-	return nil
+	if hr.fallback != nil {
+		return hr.fallback, nil
+	}
+	return emptyRouter, nil
 }
 
 func (hr *HostRouter) iterate(fn func(string, Router)) {
@@ -47,6 +76,9 @@ func (hr *HostRouter) iterate(fn func(string, Router)) {
 	for i := range routers {
 		fn(hosts[i], routers[i])
 	}
+	if hr.fallback != nil {
+		fn("", hr.fallback)
+	}
 }
 
 // Init init handlers and filters, websocket handlers
@@ -59,6 +91,16 @@ func (hr *HostRouter) Init(initHandler func(Handler) bool,
 	})
 }
 
+// SetLiveInitializer pass the initializer of routes added while serving to
+// routers which accept it
+func (hr *HostRouter) SetLiveInitializer(initialize func(ServerInitializer) error) {
+	hr.iterate(func(_ string, rt Router) {
+		if lr, is := rt.(LiveRouter); is {
+			lr.SetLiveInitializer(initialize)
+		}
+	})
+}
+
 // Destroy destroy router, also responsible for destroy all handlers and filters
 func (hr *HostRouter) Destroy() {
 	hr.iterate(func(_ string, rt Router) {
@@ -67,27 +109,37 @@ func (hr *HostRouter) Destroy() {
 }
 
 // MatchHandlerFilters match given url to find all matched filters and final handler
-func (hr *HostRouter) MatchHandlerFilters(url *url.URL) (handler Handler, indexer URLVarIndexer, filters []Filter) {
-	if router := hr.match(url); router != nil {
-		handler, indexer, filters = router.MatchHandlerFilters(url)
-	}
-	return
+func (hr *HostRouter) MatchHandlerFilters(url *url.URL) (Handler, URLVarIndexer, []Filter) {
+	router, vars := hr.match(url)
+	handler, indexer, filters := router.MatchHandlerFilters(url)
+	return handler, withHostVars(indexer, vars), filters
 }
 
 // MatchWebSocketHandler match given url to find a matched websocket handler
-func (hr *HostRouter) MatchWebSocketHandler(url *url.URL) (handler WebSocketHandler, indexer URLVarIndexer) {
-	if router := hr.match(url); router != nil {
-		handler, indexer = router.MatchWebSocketHandler(url)
-	}
-	return
+func (hr *HostRouter) MatchWebSocketHandler(url *url.URL) (WebSocketHandler, URLVarIndexer, []Filter) {
+	router, vars := hr.match(url)
+	handler, indexer, filters := router.MatchWebSocketHandler(url)
+	return handler, withHostVars(indexer, vars), filters
 }
 
-// MatchTaskHandler
-func (hr *HostRouter) MatchTaskHandler(url *url.URL) (handler TaskHandler, indexer URLVarIndexer) {
-	if router := hr.match(url); router != nil {
-		handler, indexer = router.MatchTaskHandler(url)
-	}
-	return
+// MatchTaskHandler match given url to find a matched task handler
+func (hr *HostRouter) MatchTaskHandler(url *url.URL) (TaskHandler, URLVarIndexer, []Filter) {
+	router, vars := hr.match(url)
+	handler, indexer, filters := router.MatchTaskHandler(url)
+	return handler, withHostVars(indexer, vars), filters
+}
+
+// Routes return informations of all routes of all hosts, host of fallback
+// router's routes is empty
+func (hr *HostRouter) Routes() []RouteInfo {
+	var routes []RouteInfo
+	hr.iterate(func(host string, rt Router) {
+		for _, r := range rt.Routes() {
+			r.Host = host
+			routes = append(routes, r)
+		}
+	})
+	return routes
 }
 
 type indentWriter struct {
@@ -108,8 +160,53 @@ func (w indentWriter) Write(data []byte) (int, error) {
 
 func (hr *HostRouter) PrintRouteTree(w io.Writer) {
 	hr.iterate(func(ident string, rt Router) {
+		if ident == "" {
+			ident = "(fallback)"
+		}
 		if _, e := sys.WriteStrln(w, ident); e == nil {
 			rt.PrintRouteTree(indentWriter{w})
 		}
 	})
 }
+
+// withHostVars wrap url variables with host variables if there is any
+func withHostVars(indexer URLVarIndexer, vars map[string]string) URLVarIndexer {
+	if len(vars) == 0 {
+		return indexer
+	}
+	return hostVarIndexer{URLVarIndexer: indexer, vars: vars}
+}
+
+// URLVar return value of host or path variable
+func (v hostVarIndexer) URLVar(name string) string {
+	if value, has := v.vars[name]; has {
+		return value
+	}
+	return v.URLVarIndexer.URLVar(name)
+}
+
+// URLVarDef return value of host or path variable, if not exist, return
+// default value
+func (v hostVarIndexer) URLVarDef(name string, defvalue string) string {
+	if value, has := v.vars[name]; has {
+		return value
+	}
+	return v.URLVarIndexer.URLVarDef(name, defvalue)
+}
+
+// ScanURLVar scan value of host or path variable into address
+func (v hostVarIndexer) ScanURLVar(name string, addr interface{}) error {
+	if value, has := v.vars[name]; has {
+		return ref.UnmarshalPrimitive(value, reflect.ValueOf(addr))
+	}
+	return v.URLVarIndexer.ScanURLVar(name, addr)
+}
+
+// URLVars return all host and path variables and their values
+func (v hostVarIndexer) URLVars() map[string]string {
+	vars := v.URLVarIndexer.URLVars()
+	for name, value := range v.vars {
+		vars[name] = value
+	}
+	return vars
+}
@@ -0,0 +1,144 @@
+package routers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cosiner/golib/test"
+	"github.com/cosiner/zerver"
+)
+
+func TestHostMatcher(t *testing.T) {
+	tt := test.WrapTest(t)
+	var m hostMatcher
+	var err error
+	for i, p := range []string{"*sub.example.com", ":tenant.example.com", "api.example.com:8080"} {
+		m, err = m.add(p, i)
+		tt.AssertNil(err)
+	}
+	for _, p := range []string{"a.*.com", "a..com", ":.com"} {
+		_, err = m.add(p, 0)
+		tt.AssertTrue(err != nil)
+	}
+
+	tests := []struct {
+		host  string
+		index int
+		vars  map[string]string
+	}{
+		{"API.example.com", 2, nil},
+		{"api.example.com:80", 2, nil},
+		{"foo.example.com.", 1, map[string]string{"tenant": "foo"}},
+		{"a.b.example.com", 0, map[string]string{"sub": "a.b"}},
+		{"example.com", -1, nil},
+		{"foo.example.org", -1, nil},
+	}
+	for _, test := range tests {
+		index, vars := m.match(test.host)
+		tt.AssertEq(index, test.index)
+		tt.AssertEq(vars, test.vars)
+	}
+}
+
+func TestHostRouter(t *testing.T) {
+	tt := test.WrapTest(t)
+	hr := NewHostRouter()
+	tenant, fallback := zerver.NewRouter(), zerver.NewRouter()
+	tt.AssertNil(tenant.Get("/users/:id", func(req zerver.Request, resp zerver.Response) {
+		resp.Write([]byte(req.URLVar("tenant") + " " + req.URLVar("id")))
+	}))
+	tt.AssertNil(tenant.Mount("/files/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := zerver.URLVars(r)
+		w.Write([]byte(vars["tenant"] + " " + vars["id"]))
+	})))
+	tt.AssertNil(fallback.Get("/", zerver.EmptyHandlerFunc))
+	tt.AssertNil(hr.AddRouter(":tenant.example.com", tenant))
+
+	s := zerver.NewServer()
+	s.Router = hr
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "http://foo.example.com:8080/users/1", nil))
+	tt.AssertEq(w.Body.String(), "foo 1")
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/files/2", nil)
+	r.Host = "bar.example.com"
+	s.ServeHTTP(w, r)
+	tt.AssertEq(w.Body.String(), "bar 2")
+	tt.AssertEq(r.URL.Host, "")
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "http://other.com/", nil))
+	tt.AssertEq(w.Code, http.StatusNotFound)
+
+	hr.SetFallback(fallback)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "http://other.com/", nil))
+	tt.AssertEq(w.Code, http.StatusOK)
+}
+
+func TestHostRootFilters(t *testing.T) {
+	tt := test.WrapTest(t)
+	header := func(value string) zerver.FilterFunc {
+		return func(req zerver.Request, resp zerver.Response, chain zerver.FilterChain) {
+			resp.SetHeader("X-Root", value)
+			chain(req, resp)
+		}
+	}
+	hr := &HostRootFilters{}
+	tt.AssertNil(hr.AddRootFilters("api.example.com", zerver.NewRootFilters(nil)))
+	hr.filters[0].AddFuncFilter(header("api"))
+	hr.SetFallback(zerver.NewRootFilters(nil))
+	hr.fallback.AddFuncFilter(header("fallback"))
+
+	s := zerver.NewServer()
+	s.RootFilters = hr
+	tt.AssertNil(s.Get("/", zerver.EmptyHandlerFunc))
+	// url of server request has no host
+	for host, value := range map[string]string{
+		"api.example.com": "api",
+		"other.com":       "fallback",
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = host
+		s.ServeHTTP(w, r)
+		tt.AssertEq(w.Header().Get("X-Root"), value)
+	}
+}
+
+type recordFilter struct {
+	zerver.FilterFunc
+	name   string
+	fail   bool
+	events *[]string
+}
+
+func (f recordFilter) Init(*zerver.Server) error {
+	if f.fail {
+		return errors.New("init " + f.name)
+	}
+	*f.events = append(*f.events, "init "+f.name)
+	return nil
+}
+
+func (f recordFilter) Destroy() {
+	*f.events = append(*f.events, "destroy "+f.name)
+}
+
+func TestHostRootFiltersInitFail(t *testing.T) {
+	tt := test.WrapTest(t)
+	var events []string
+	hr := &HostRootFilters{}
+	tt.AssertNil(hr.AddRootFilters("api.example.com", zerver.NewRootFilters([]zerver.Filter{
+		recordFilter{name: "api", events: &events},
+	})))
+	tt.AssertNil(hr.AddRootFilters("admin.example.com", zerver.NewRootFilters([]zerver.Filter{
+		recordFilter{name: "admin", fail: true, events: &events},
+	})))
+	tt.AssertTrue(hr.Init(zerver.NewServer()) != nil)
+	tt.AssertEq(strings.Join(events, ","), "init api,destroy api")
+}
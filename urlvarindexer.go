@@ -2,6 +2,7 @@ package zerver
 
 import (
 	"reflect"
+	"time"
 
 	. "github.com/cosiner/golib/errors"
 
@@ -15,22 +16,81 @@ type (
 		URLVar(name string) string
 		URLVarDef(name string, defvalue string) string
 		ScanURLVar(name string, addr interface{}) error
+		// URLVars return all variables and their values
+		URLVars() map[string]string
+		// Pattern return the pattern of matched route, it's empty if not matched
+		Pattern() string
+		// Meta return metadata of matched route attached by Router.SetMeta
+		Meta(key string) interface{}
 		destroySelf() // avoid confilict with Request interface
+		varIndexer() *urlVarIndexer
 	}
 
 	// urlVarIndexer is an implementation of URLVarIndexer
 	urlVarIndexer struct {
 		vars   map[string]int // url variables and indexs of sections splited by '/'
 		values []string       // all url variable values
+
+		timeout time.Duration // timeout of matched route
+		pattern string        // pattern of matched route
+		meta    map[string]interface{}
+		// owner is released when indexer is destroyed, such as the snapshot
+		// of route tree the request matched
+		owner interface {
+			release()
+		}
 	}
 )
 
 func (v *urlVarIndexer) destroySelf() {
 	v.values = v.values[:0]
 	v.vars = nil
+	v.timeout = 0
+	v.pattern, v.meta = "", nil
+	if v.owner != nil {
+		v.owner.release()
+		v.owner = nil
+	}
 	Pool.recycleVarIndexer(v)
 }
 
+// varIndexer return the actual urlVarIndexer
+func (v *urlVarIndexer) varIndexer() *urlVarIndexer {
+	return v
+}
+
+// clone copy url variables to a new indexer
+func (v *urlVarIndexer) clone() *urlVarIndexer {
+	c := Pool.newVarIndexer()
+	c.vars, c.values, c.timeout = v.vars, append(c.values, v.values...), v.timeout
+	c.pattern, c.meta = v.pattern, v.meta
+	return c
+}
+
+// setRoute set variables, pattern and metadata of matched route
+func (v *urlVarIndexer) setRoute(vars map[string]int, rp *routeProcessor) {
+	v.vars, v.pattern, v.meta = vars, rp.pattern, rp.meta
+}
+
+// Pattern return the pattern of matched route
+func (v *urlVarIndexer) Pattern() string {
+	return v.pattern
+}
+
+// Meta return metadata of matched route
+func (v *urlVarIndexer) Meta(key string) interface{} {
+	return v.meta[key]
+}
+
+// URLVars return all named variables and their values
+func (v *urlVarIndexer) URLVars() map[string]string {
+	vars := make(map[string]string, len(v.vars))
+	for name, index := range v.vars {
+		vars[name] = v.values[index]
+	}
+	return vars
+}
+
 // URLVar return values of variable
 func (v *urlVarIndexer) URLVar(name string) string {
 	if index, has := v.vars[name]; has {
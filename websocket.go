@@ -1,6 +1,7 @@
 package zerver
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/url"
@@ -24,6 +25,11 @@ type (
 		RemoteIP() string
 		UserAgent() string
 		URL() *url.URL
+		// Context return context of connection, it's inherited from the
+		// upgrade request
+		Context() context.Context
+		// WithContext replace context of connection
+		WithContext(ctx context.Context)
 		serverGetter
 	}
 
@@ -33,6 +39,7 @@ type (
 		*websocket.Conn
 		URLVarIndexer
 		request *http.Request
+		ctx     context.Context
 	}
 
 	// WebSocketHandlerFunc is the websocket connection handler
@@ -49,11 +56,13 @@ type (
 // newWebSocketConn wrap a exist websocket connection and url variables to a
 // new webSocketConn
 func newWebSocketConn(s serverGetter, conn *websocket.Conn, varIndexer URLVarIndexer) *webSocketConn {
+	request := conn.Request()
 	return &webSocketConn{
 		serverGetter:  s,
 		Conn:          conn,
 		URLVarIndexer: varIndexer,
-		request:       conn.Request(),
+		request:       request,
+		ctx:           request.Context(),
 	}
 }
 
@@ -69,6 +78,17 @@ func (wsc *webSocketConn) RemoteIP() string {
 	return strings.Split(wsc.RemoteAddr(), ":")[0]
 }
 
+func (wsc *webSocketConn) Context() context.Context {
+	return wsc.ctx
+}
+
+func (wsc *webSocketConn) WithContext(ctx context.Context) {
+	if ctx == nil {
+		panic("nil context")
+	}
+	wsc.ctx = ctx
+}
+
 // UserAgent return user's agent identify
 func (wsc *webSocketConn) UserAgent() string {
 	return wsc.request.Header.Get(HEADER_USERAGENT)